@@ -2,18 +2,61 @@ package main
 
 import (
 	"log/slog"
+	"math/big"
+	"time"
 
 	"eth-fetcher.ddzhalev.net/internal/models"
 	"eth-fetcher.ddzhalev.net/internal/web3"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/ethclient"
 )
 
 type application struct {
-	logger             *slog.Logger
-	transactions       *models.TransactionModel
-	users              *models.UserModel
-	personInfoEvents   *models.PersonInfoEventModel
-	ethClient          *ethclient.Client
-	jwtSecret          string
-	contractInteractor *web3.PersonInfoContractInteractor
+	logger               *slog.Logger
+	transactions         *models.TransactionModel
+	users                *models.UserModel
+	personInfoEvents     *models.PersonInfoEventModel
+	pendingTransactions  *models.PendingTransactionModel
+	transactionLogs      *models.TransactionLogModel
+	contractABIs         *models.ContractABIModel
+	tokenTransfers       *models.TokenTransferModel
+	ingestJobs           *models.IngestJobModel
+	checkpoints          *models.CheckpointModel
+	outgoingTransactions *models.OutgoingTransactionModel
+	ethClient            *ethclient.Client
+	chainID              *big.Int
+	jwtSecret            string
+	contractInteractor   *web3.PersonInfoContractInteractor
+	indexer              *indexerState
+	ingestRunner         *ingestRunner
+	eventListenerHealth  *web3.ListenerHealth
+	config               config
+}
+
+type config struct {
+	fetchWorkers           int
+	rpcBatchSize           int
+	maxHashesPerRequest    int
+	pendingRecheckInterval time.Duration
+	pendingTimeout         time.Duration
+	maxIngestBlocks        int
+	indexerEnabled         bool
+	indexerAddresses       []common.Address
+	indexerStartBlock      int
+	confirmationDepth      int
+	reorgCheckInterval     time.Duration
+	deploymentBlock        int
+	backfillChunkSize      int
+	listenerMinBackoff     time.Duration
+	listenerMaxBackoff     time.Duration
+	eventPollInterval      time.Duration
+	outgoingCheckInterval  time.Duration
+	outgoingTimeout        time.Duration
+	outgoingDropAfter      time.Duration
+	gasLimitMultiplier     float64
+	maxFeePerGasGwei       float64
+	maxPriorityFeeGwei     float64
+	feeBumpPercent         int
+	speedupAfter           time.Duration
+	maxFeeBumps            int
 }
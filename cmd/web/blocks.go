@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"strings"
+
+	"eth-fetcher.ddzhalev.net/internal/web3"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+type block struct {
+	Number            uint64   `json:"number"`
+	Hash              string   `json:"hash"`
+	ParentHash        string   `json:"parentHash"`
+	Timestamp         uint64   `json:"timestamp"`
+	Miner             string   `json:"miner"`
+	GasLimit          uint64   `json:"gasLimit"`
+	GasUsed           uint64   `json:"gasUsed"`
+	BaseFeePerGas     *string  `json:"baseFeePerGas"`
+	TransactionCount  int      `json:"transactionCount"`
+	TransactionHashes []string `json:"transactionHashes"`
+}
+
+var errInvalidBlockID = errors.New("block must be a decimal number, a 32-byte hex hash or \"latest\"")
+
+// fetchBlock looks up a block by its decimal number, its hash or "latest".
+func (app *application) fetchBlock(ctx context.Context, numberOrHash string) (*web3.BlockSummary, error) {
+	numberOrHash = strings.ToLower(strings.TrimSpace(numberOrHash))
+
+	if numberOrHash == "latest" {
+		return web3.FetchBlockByNumber(ctx, app.ethClient.Client(), nil)
+	}
+
+	if isTransactionHash(numberOrHash) {
+		return web3.FetchBlockByHash(ctx, app.ethClient.Client(), common.HexToHash(numberOrHash))
+	}
+
+	number, ok := new(big.Int).SetString(numberOrHash, 10)
+	if !ok || number.Sign() < 0 {
+		return nil, errInvalidBlockID
+	}
+	return web3.FetchBlockByNumber(ctx, app.ethClient.Client(), number)
+}
+
+func mapBlockSummary(summary *web3.BlockSummary) *block {
+	header := summary.Header
+
+	b := &block{
+		Number:            header.Number.Uint64(),
+		Hash:              summary.Hash.Hex(),
+		ParentHash:        header.ParentHash.Hex(),
+		Timestamp:         header.Time,
+		Miner:             header.Coinbase.Hex(),
+		GasLimit:          header.GasLimit,
+		GasUsed:           header.GasUsed,
+		TransactionCount:  len(summary.TransactionHashes),
+		TransactionHashes: blockTransactionHashes(summary),
+	}
+	if header.BaseFee != nil {
+		baseFee := header.BaseFee.String()
+		b.BaseFeePerGas = &baseFee
+	}
+	return b
+}
+
+func blockTransactionHashes(summary *web3.BlockSummary) []string {
+	hashes := make([]string, len(summary.TransactionHashes))
+	for i, hash := range summary.TransactionHashes {
+		hashes[i] = hash.Hex()
+	}
+	return hashes
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"eth-fetcher.ddzhalev.net/internal/models"
+	"eth-fetcher.ddzhalev.net/internal/web3"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// loadContractABIs returns the parsed ABIs known for addresses, keyed by address.
+// Uploaded ABIs take precedence over the generated SimplePersonInfoContract ABI.
+func (app *application) loadContractABIs(addresses []string) (map[string]*abi.ABI, error) {
+	stored, err := app.contractABIs.GetMultiple(addresses)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get contract ABIs from the DB: %w", err)
+	}
+
+	abis := make(map[string]*abi.ABI)
+	personInfoAddress := web3.PersonInfoContractAddress().Hex()
+	for _, address := range addresses {
+		if contractABI, ok := stored[address]; ok {
+			parsed, err := web3.ParseABI(contractABI.ABI)
+			if err != nil {
+				app.logger.Warn("ignoring invalid stored ABI", "address", address, "error", err)
+				continue
+			}
+			abis[address] = parsed
+		} else if address == personInfoAddress {
+			parsed, err := web3.SimplePersonInfoContractMetaData.GetAbi()
+			if err != nil {
+				return nil, err
+			}
+			abis[address] = parsed
+		}
+	}
+
+	return abis, nil
+}
+
+// decodeTransactions fills in the decoded input of transactions and the decoded
+// events of any logs attached to them, leaving unknown signatures undecoded.
+func (app *application) decodeTransactions(transactions []*models.Transaction) error {
+	var addresses []string
+	for _, tx := range transactions {
+		if tx.To != nil {
+			addresses = append(addresses, *tx.To)
+		}
+		for _, log := range tx.Logs {
+			addresses = append(addresses, log.Address)
+		}
+	}
+
+	abis, err := app.loadContractABIs(addresses)
+	if err != nil {
+		return err
+	}
+
+	for _, tx := range transactions {
+		if tx.To != nil && tx.Input != "" {
+			decoded, err := web3.DecodeInput(abis[*tx.To], common.FromHex(tx.Input))
+			if err == nil {
+				tx.DecodedInput = decoded
+			} else if !errors.Is(err, web3.ErrUnknownSignature) {
+				app.logger.Warn("failed to decode transaction input", "hash", tx.TransactionHash, "error", err)
+			}
+		}
+
+		app.decodeLogsWith(abis, tx.Logs)
+	}
+
+	return nil
+}
+
+// decodeLogs fills in the decoded events of logs, leaving unknown signatures undecoded.
+func (app *application) decodeLogs(logs []*models.TransactionLog) error {
+	addresses := make([]string, len(logs))
+	for i, log := range logs {
+		addresses[i] = log.Address
+	}
+
+	abis, err := app.loadContractABIs(addresses)
+	if err != nil {
+		return err
+	}
+
+	app.decodeLogsWith(abis, logs)
+	return nil
+}
+
+func (app *application) decodeLogsWith(abis map[string]*abi.ABI, logs []*models.TransactionLog) {
+	for _, log := range logs {
+		topics := make([]common.Hash, len(log.Topics))
+		for i, topic := range log.Topics {
+			topics[i] = common.HexToHash(topic)
+		}
+
+		decoded, err := web3.DecodeLog(abis[log.Address], topics, common.FromHex(log.Data))
+		if err == nil {
+			log.Decoded = decoded
+		} else if !errors.Is(err, web3.ErrUnknownSignature) {
+			app.logger.Warn("failed to decode log", "hash", log.TransactionHash, "logIndex", log.LogIndex, "error", err)
+		}
+	}
+}
@@ -3,14 +3,58 @@ package main
 import (
 	"context"
 	"log"
+	"time"
+
+	"eth-fetcher.ddzhalev.net/internal/web3"
 )
 
+// StartEventListener runs the PersonInfoUpdated listener in the background and
+// restarts it whenever it stops. Restarts are delayed with exponential backoff
+// between EVENT_LISTENER_MIN_BACKOFF and EVENT_LISTENER_MAX_BACKOFF, and each
+// one reconnects the event source. Events emitted while the listener was
+// down are backfilled from its checkpoint when it resubscribes.
 func (app *application) StartEventListener() {
 	go func() {
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
 
 		log.Println("Starting event listener in background...")
-		app.contractInteractor.ListenForEvents(ctx, app.personInfoEvents)
+
+		backoff := app.config.listenerMinBackoff
+		for attempt := 0; ; attempt++ {
+			if attempt > 0 {
+				err := app.contractInteractor.Reconnect(ctx)
+				if err != nil {
+					app.eventListenerHealth.RecordFailure(err)
+					app.logger.Error("failed to reconnect event source", "error", err, "retryIn", backoff)
+					backoff = app.waitBackoff(backoff)
+					continue
+				}
+			}
+
+			started := time.Now()
+			err := app.contractInteractor.ListenForEvents(ctx, app.personInfoEvents, app.checkpoints, web3.EventBackfillConfig{
+				DeploymentBlock: uint64(app.config.deploymentBlock),
+				ChunkSize:       uint64(app.config.backfillChunkSize),
+			}, app.eventListenerHealth)
+			if ctx.Err() != nil {
+				return
+			}
+
+			// A listener that ran for a while was healthy, so start over with a short delay.
+			if time.Since(started) > app.config.listenerMaxBackoff {
+				backoff = app.config.listenerMinBackoff
+			}
+
+			app.eventListenerHealth.RecordFailure(err)
+			app.logger.Error("event listener stopped, reconnecting", "error", err, "retryIn", backoff)
+			backoff = app.waitBackoff(backoff)
+		}
 	}()
 }
+
+// waitBackoff sleeps for backoff and returns the next, doubled, delay.
+func (app *application) waitBackoff(backoff time.Duration) time.Duration {
+	time.Sleep(backoff)
+	return min(2*backoff, app.config.listenerMaxBackoff)
+}
@@ -0,0 +1,419 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"eth-fetcher.ddzhalev.net/internal/models"
+	"eth-fetcher.ddzhalev.net/internal/web3"
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// headerCache deduplicates block header lookups made while fetching a single
+// batch of transactions, so transactions from the same block share one RPC call.
+type headerCache struct {
+	client  *ethclient.Client
+	mu      sync.Mutex
+	entries map[common.Hash]*headerEntry
+}
+
+type headerEntry struct {
+	ready  chan struct{}
+	header *types.Header
+	err    error
+}
+
+func newHeaderCache(client *ethclient.Client) *headerCache {
+	return &headerCache{
+		client:  client,
+		entries: make(map[common.Hash]*headerEntry),
+	}
+}
+
+func (c *headerCache) get(ctx context.Context, blockHash common.Hash) (*types.Header, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[blockHash]
+	if !ok {
+		entry = &headerEntry{ready: make(chan struct{})}
+		c.entries[blockHash] = entry
+	}
+	c.mu.Unlock()
+
+	if !ok {
+		entry.header, entry.err = c.client.HeaderByHash(ctx, blockHash)
+		close(entry.ready)
+	}
+
+	select {
+	case <-entry.ready:
+		return entry.header, entry.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+const (
+	errCodeNotFound    = "not_found"
+	errCodePending     = "pending"
+	errCodeInvalidHash = "invalid_hash"
+	errCodeUpstream    = "upstream_error"
+)
+
+// transactionError describes why a single hash of a multi-hash lookup failed.
+type transactionError struct {
+	Hash    string `json:"hash"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func newTransactionError(hashString string, err error) *transactionError {
+	code := errCodeUpstream
+	switch {
+	case errors.Is(err, ethereum.NotFound):
+		code = errCodeNotFound
+	case errors.Is(err, web3.ErrTransactionPending):
+		code = errCodePending
+	}
+
+	return &transactionError{Hash: hashString, Code: code, Message: err.Error()}
+}
+
+// fetchResult holds the stored transaction, the pending transaction or the
+// error for one requested hash.
+type fetchResult struct {
+	tx      *models.Transaction
+	pending *models.PendingTransaction
+	err     *transactionError
+}
+
+// transactionLookup is the outcome of a multi-hash lookup, with every slice in
+// the order of the requested hashes.
+type transactionLookup struct {
+	transactions []*models.Transaction
+	pending      []*models.PendingTransaction
+	errors       []*transactionError
+}
+
+// fetchTransactions looks up hashStrings, serving stored transactions from the DB
+// and fetching the rest from the node. Stored rows that predate the gas and fee
+// columns are fetched again to backfill them, and served as they are if that
+// fails. Missing transactions are fetched with JSON-RPC batch requests when
+// enabled, falling back to individual calls if the node rejects batches.
+// Transactions still in the mempool are kept in the pending store, and hashes
+// the node no longer knows are served from there if present. Failures of
+// individual hashes are returned as transactionErrors; the returned error is
+// reserved for failures that affect the whole request, such as DB errors or a
+// cancelled context.
+func (app *application) fetchTransactions(ctx context.Context, hashStrings []string) (*transactionLookup, error) {
+	results := make([]fetchResult, len(hashStrings))
+	stale := make(map[int]*models.Transaction)
+	var missing []int
+	for i, hashString := range hashStrings {
+		if !isTransactionHash(hashString) {
+			results[i].err = &transactionError{Hash: hashString, Code: errCodeInvalidHash, Message: "not a 32-byte hex transaction hash"}
+			continue
+		}
+
+		tx, err := app.transactions.Get(hashString)
+		if err == nil && !tx.NeedsBackfill {
+			results[i].tx = tx
+			continue
+		}
+
+		if err == nil {
+			stale[i] = tx
+			missing = append(missing, i)
+			continue
+		}
+
+		if err.Error() != "transaction not found" {
+			return nil, fmt.Errorf("failed to get transaction %s from the DB: %w", hashString, err)
+		}
+		missing = append(missing, i)
+	}
+
+	if len(missing) > 0 {
+		err := app.fetchMissingTransactions(ctx, hashStrings, missing, results)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	lookup := &transactionLookup{
+		transactions: []*models.Transaction{},
+		pending:      []*models.PendingTransaction{},
+		errors:       []*transactionError{},
+	}
+	for i, result := range results {
+		if result.err != nil && stale[i] != nil {
+			app.logger.Warn("failed to backfill transaction", "hash", hashStrings[i], "error", result.err.Message)
+			result = fetchResult{tx: stale[i]}
+		}
+
+		if result.err != nil && result.err.Code == errCodeNotFound {
+			pendingTx, err := app.pendingTransactions.Get(hashStrings[i])
+			if err == nil {
+				result = fetchResult{pending: pendingTx}
+			} else if err.Error() != "pending transaction not found" {
+				return nil, fmt.Errorf("failed to get pending transaction %s from the DB: %w", hashStrings[i], err)
+			}
+		}
+
+		switch {
+		case result.err != nil:
+			lookup.errors = append(lookup.errors, result.err)
+		case result.pending != nil:
+			lookup.pending = append(lookup.pending, result.pending)
+		default:
+			lookup.transactions = append(lookup.transactions, result.tx)
+		}
+	}
+
+	return lookup, nil
+}
+
+func (app *application) fetchMissingTransactions(ctx context.Context, hashStrings []string, missing []int, results []fetchResult) error {
+	if app.config.rpcBatchSize > 0 {
+		err := app.fetchTransactionsBatch(ctx, hashStrings, missing, results)
+		if err == nil {
+			return nil
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		var batchErr *batchUnavailableError
+		if !errors.As(err, &batchErr) {
+			return err
+		}
+		app.logger.Warn("falling back to individual RPC calls", "error", err)
+	}
+
+	return app.fetchTransactionsConcurrently(ctx, hashStrings, missing, results)
+}
+
+type batchUnavailableError struct {
+	err error
+}
+
+func (e *batchUnavailableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *batchUnavailableError) Unwrap() error {
+	return e.err
+}
+
+func (app *application) fetchTransactionsBatch(ctx context.Context, hashStrings []string, missing []int, results []fetchResult) error {
+	hashes := make([]common.Hash, len(missing))
+	for i, index := range missing {
+		hashes[i] = common.HexToHash(hashStrings[index])
+	}
+
+	batchResults, err := web3.FetchTransactionsBatch(ctx, app.ethClient.Client(), hashes, app.config.rpcBatchSize)
+	if err != nil {
+		return &batchUnavailableError{err: err}
+	}
+
+	for i, index := range missing {
+		if batchResults[i].Err != nil {
+			results[index].err = newTransactionError(hashStrings[index], batchResults[i].Err)
+			continue
+		}
+
+		results[index], err = app.storeTransaction(hashStrings[index], batchResults[i].Data)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fetchTransactionsConcurrently fetches the missing hashes one by one using a
+// bounded pool of workers. Errors affecting the whole request cancel all
+// outstanding work.
+func (app *application) fetchTransactionsConcurrently(ctx context.Context, hashStrings []string, missing []int, results []fetchResult) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	headers := newHeaderCache(app.ethClient)
+	jobs := make(chan int)
+	errs := make(chan error, 1)
+
+	var wg sync.WaitGroup
+	for range min(max(app.config.fetchWorkers, 1), len(missing)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				data, err := app.fetchTransactionData(ctx, hashStrings[i], headers)
+				if err != nil {
+					results[i].err = newTransactionError(hashStrings[i], err)
+					continue
+				}
+
+				results[i], err = app.storeTransaction(hashStrings[i], data)
+				if err != nil {
+					select {
+					case errs <- err:
+					default:
+					}
+					cancel()
+				}
+			}
+		}()
+	}
+
+dispatch:
+	for _, i := range missing {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	select {
+	case err := <-errs:
+		return err
+	default:
+	}
+
+	return ctx.Err()
+}
+
+func (app *application) fetchTransactionData(ctx context.Context, hashString string, headers *headerCache) (*web3.TransactionData, error) {
+	ethTx, isPending, err := app.ethClient.TransactionByHash(ctx, common.HexToHash(hashString))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch transaction %s: %w", hashString, err)
+	}
+
+	if isPending {
+		return &web3.TransactionData{Transaction: ethTx, Pending: true}, nil
+	}
+
+	receipt, err := app.ethClient.TransactionReceipt(ctx, ethTx.Hash())
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch receipt for transaction %s: %w", hashString, err)
+	}
+
+	blockHeader, err := headers.get(ctx, receipt.BlockHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch block header for transaction %s: %w", hashString, err)
+	}
+
+	return &web3.TransactionData{
+		Transaction: ethTx,
+		Receipt:     receipt,
+		Header:      blockHeader,
+	}, nil
+}
+
+// storeTransaction converts and inserts a fetched transaction together with its
+// logs and token transfers, promoting it out of the pending store, or upserts it into the pending
+// store if it has not been mined yet. Conversion failures are reported in the
+// fetchResult, while the returned error means a DB write failed.
+func (app *application) storeTransaction(hashString string, data *web3.TransactionData) (fetchResult, error) {
+	if data.Pending {
+		return app.storePendingTransaction(hashString, data.Transaction)
+	}
+
+	tx, err := mapTransactionToModel(data.Transaction, data.Receipt, data.Header, app.chainID)
+	if err != nil {
+		err = fmt.Errorf("failed to convert transaction %s: %w", hashString, err)
+		return fetchResult{err: newTransactionError(hashString, err)}, nil
+	}
+
+	err = app.transactions.Insert(tx)
+	if err != nil {
+		return fetchResult{}, fmt.Errorf("failed to insert transaction %s: %w", hashString, err)
+	}
+
+	logs := mapLogsToModel(data.Receipt.Logs)
+	err = app.transactionLogs.InsertMany(logs)
+	if err != nil {
+		return fetchResult{}, fmt.Errorf("failed to insert logs of transaction %s: %w", hashString, err)
+	}
+
+	err = app.tokenTransfers.InsertMany(mapTokenTransfersToModel(logs))
+	if err != nil {
+		return fetchResult{}, fmt.Errorf("failed to insert token transfers of transaction %s: %w", hashString, err)
+	}
+
+	err = app.pendingTransactions.Delete(tx.TransactionHash)
+	if err != nil {
+		return fetchResult{}, fmt.Errorf("failed to remove pending transaction %s: %w", hashString, err)
+	}
+
+	return fetchResult{tx: tx}, nil
+}
+
+func (app *application) storePendingTransaction(hashString string, ethTx *types.Transaction) (fetchResult, error) {
+	pendingTx, err := mapPendingTransactionToModel(ethTx, app.chainID)
+	if err != nil {
+		err = fmt.Errorf("failed to convert pending transaction %s: %w", hashString, err)
+		return fetchResult{err: newTransactionError(hashString, err)}, nil
+	}
+
+	err = app.pendingTransactions.Upsert(pendingTx)
+	if err != nil {
+		return fetchResult{}, fmt.Errorf("failed to store pending transaction %s: %w", hashString, err)
+	}
+
+	return fetchResult{pending: pendingTx}, nil
+}
+
+// loadTransactionLogs returns the logs of transactions keyed by transaction hash.
+// Receipts are fetched again for transactions stored before their logs were kept.
+// Transactions whose receipt cannot be fetched are left out of the logs and
+// reported as upstream errors, so that the rest of the response can be served.
+func (app *application) loadTransactionLogs(ctx context.Context, transactions []*models.Transaction) (map[string][]*models.TransactionLog, []*transactionError, error) {
+	hashes := make([]string, len(transactions))
+	for i, tx := range transactions {
+		hashes[i] = tx.TransactionHash
+	}
+
+	logs, err := app.transactionLogs.GetByTransactionHashes(hashes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get transaction logs from the DB: %w", err)
+	}
+
+	var txErrors []*transactionError
+	for _, tx := range transactions {
+		if len(logs[tx.TransactionHash]) == tx.LogsCount {
+			if logs[tx.TransactionHash] == nil {
+				logs[tx.TransactionHash] = []*models.TransactionLog{}
+			}
+			continue
+		}
+
+		receipt, err := app.ethClient.TransactionReceipt(ctx, common.HexToHash(tx.TransactionHash))
+		if err != nil {
+			delete(logs, tx.TransactionHash)
+			txErrors = append(txErrors, &transactionError{
+				Hash:    tx.TransactionHash,
+				Code:    errCodeUpstream,
+				Message: fmt.Sprintf("failed to fetch receipt: %s", err),
+			})
+			continue
+		}
+
+		txLogs := mapLogsToModel(receipt.Logs)
+		err = app.transactionLogs.InsertMany(txLogs)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to insert logs of transaction %s: %w", tx.TransactionHash, err)
+		}
+		logs[tx.TransactionHash] = txLogs
+	}
+
+	return logs, txErrors, nil
+}
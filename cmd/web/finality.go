@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"eth-fetcher.ddzhalev.net/internal/models"
+	"eth-fetcher.ddzhalev.net/internal/web3"
+	ethereum "github.com/ethereum/go-ethereum"
+)
+
+// StartReorgValidator periodically checks the stored transactions and
+// PersonInfoUpdated events that are not finalized yet against the canonical
+// chain. Transactions whose block was reorganized away are fetched again and
+// updated, or removed if the canonical chain no longer includes them, while such
+// events are removed. Records at least CONFIRMATION_DEPTH blocks deep are marked
+// finalized and no longer checked.
+func (app *application) StartReorgValidator() {
+	go func() {
+		app.logger.Info("starting reorg validator", "interval", app.config.reorgCheckInterval, "confirmationDepth", app.config.confirmationDepth)
+
+		ticker := time.NewTicker(app.config.reorgCheckInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			err := app.validateUnfinalizedTransactions(context.Background())
+			if err != nil {
+				app.logger.Error("failed to validate unfinalized transactions", "error", err)
+			}
+
+			err = app.validateUnfinalizedPersonInfoEvents(context.Background())
+			if err != nil {
+				app.logger.Error("failed to validate unfinalized person info events", "error", err)
+			}
+		}
+	}()
+}
+
+// unfinalizedPageSize is the number of unfinalized transactions or events checked
+// per query.
+const unfinalizedPageSize = 500
+
+// validateUnfinalizedTransactions checks the unfinalized transactions within
+// CONFIRMATION_DEPTH blocks of the head page by page. Older ones are past the
+// depth at which reorgs are expected and are finalized without a check.
+func (app *application) validateUnfinalizedTransactions(ctx context.Context) error {
+	head, err := app.ethClient.BlockNumber(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get the latest block number: %w", err)
+	}
+
+	var fromBlock uint64
+	if depth := uint64(app.config.confirmationDepth); head+1 > depth {
+		fromBlock = head + 1 - depth
+	}
+
+	err = app.transactions.FinalizeBefore(fromBlock)
+	if err != nil {
+		return fmt.Errorf("failed to finalize transactions before block %d: %w", fromBlock, err)
+	}
+
+	canonical := newCanonicalHashes(app)
+	finalized := make(map[string]bool)
+	headers := newHeaderCache(app.ethClient)
+	afterBlock, afterID := fromBlock, 0
+	for {
+		transactions, err := app.transactions.GetUnfinalized(afterBlock, afterID, unfinalizedPageSize)
+		if err != nil {
+			return fmt.Errorf("failed to load unfinalized transactions: %w", err)
+		}
+
+		for _, tx := range transactions {
+			if tx.BlockNumber > head {
+				return nil
+			}
+
+			canonicalHash, err := canonical.get(ctx, tx.BlockNumber)
+			if err != nil {
+				return err
+			}
+
+			if tx.BlockHash != canonicalHash {
+				err := app.handleReorgedTransaction(ctx, tx, headers)
+				if err != nil {
+					app.logger.Error("failed to update reorged transaction", "hash", tx.TransactionHash, "error", err)
+				}
+				continue
+			}
+
+			if head-tx.BlockNumber+1 >= uint64(app.config.confirmationDepth) && !finalized[tx.BlockHash] {
+				err := app.transactions.MarkFinalized(tx.BlockHash)
+				if err != nil {
+					return fmt.Errorf("failed to finalize transactions of block %s: %w", tx.BlockHash, err)
+				}
+				finalized[tx.BlockHash] = true
+			}
+		}
+
+		if len(transactions) < unfinalizedPageSize {
+			return nil
+		}
+		last := transactions[len(transactions)-1]
+		afterBlock, afterID = last.BlockNumber, last.ID
+	}
+}
+
+// validateUnfinalizedPersonInfoEvents checks the unfinalized events within
+// CONFIRMATION_DEPTH blocks of the head page by page, finalizing older ones
+// without a check, as validateUnfinalizedTransactions does for transactions.
+func (app *application) validateUnfinalizedPersonInfoEvents(ctx context.Context) error {
+	head, err := app.ethClient.BlockNumber(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get the latest block number: %w", err)
+	}
+
+	var fromBlock uint64
+	if depth := uint64(app.config.confirmationDepth); head+1 > depth {
+		fromBlock = head + 1 - depth
+	}
+
+	err = app.personInfoEvents.FinalizeBefore(fromBlock)
+	if err != nil {
+		return fmt.Errorf("failed to finalize events before block %d: %w", fromBlock, err)
+	}
+
+	canonical := newCanonicalHashes(app)
+	checked := make(map[string]bool)
+	afterBlock, afterID := fromBlock, 0
+	for {
+		events, err := app.personInfoEvents.GetUnfinalized(afterBlock, afterID, unfinalizedPageSize)
+		if err != nil {
+			return fmt.Errorf("failed to load unfinalized events: %w", err)
+		}
+
+		for _, event := range events {
+			if event.BlockNumber > head {
+				return nil
+			}
+			if checked[event.BlockHash] {
+				continue
+			}
+			checked[event.BlockHash] = true
+
+			canonicalHash, err := canonical.get(ctx, event.BlockNumber)
+			if err != nil {
+				return err
+			}
+
+			// The listener deletes events whose log was removed, this catches the ones
+			// it missed, for example while it was reconnecting.
+			if event.BlockHash != canonicalHash {
+				err := app.personInfoEvents.DeleteByBlockHash(event.BlockHash)
+				if err != nil {
+					return fmt.Errorf("failed to delete events of block %s: %w", event.BlockHash, err)
+				}
+				app.logger.Warn("person info events removed by reorg", "blockNumber", event.BlockNumber, "blockHash", event.BlockHash)
+				continue
+			}
+
+			if head-event.BlockNumber+1 >= uint64(app.config.confirmationDepth) {
+				err := app.personInfoEvents.MarkFinalized(event.BlockHash)
+				if err != nil {
+					return fmt.Errorf("failed to finalize events of block %s: %w", event.BlockHash, err)
+				}
+			}
+		}
+
+		if len(events) < unfinalizedPageSize {
+			return nil
+		}
+		last := events[len(events)-1]
+		afterBlock, afterID = last.BlockNumber, last.ID
+	}
+}
+
+// canonicalHashes looks up and caches the canonical block hash of block numbers
+// during one validation pass. The hash is empty for blocks past the node's head.
+type canonicalHashes struct {
+	app    *application
+	hashes map[uint64]string
+}
+
+func newCanonicalHashes(app *application) *canonicalHashes {
+	return &canonicalHashes{app: app, hashes: make(map[uint64]string)}
+}
+
+func (c *canonicalHashes) get(ctx context.Context, number uint64) (string, error) {
+	if hash, ok := c.hashes[number]; ok {
+		return hash, nil
+	}
+
+	var hash string
+	summary, err := web3.FetchBlockByNumber(ctx, c.app.ethClient.Client(), new(big.Int).SetUint64(number))
+	if err != nil && !errors.Is(err, ethereum.NotFound) {
+		return "", fmt.Errorf("failed to fetch block %d: %w", number, err)
+	}
+	if err == nil {
+		hash = summary.Hash.Hex()
+	}
+
+	c.hashes[number] = hash
+	return hash, nil
+}
+
+// handleReorgedTransaction replaces a transaction whose block is no longer
+// canonical with its current state. Its logs and token transfers are dropped
+// first, as their log indexes depend on the block.
+func (app *application) handleReorgedTransaction(ctx context.Context, tx *models.Transaction, headers *headerCache) error {
+	hash := tx.TransactionHash
+
+	data, err := app.fetchTransactionData(ctx, hash, headers)
+	if err != nil && !errors.Is(err, ethereum.NotFound) {
+		return err
+	}
+
+	err = app.transactionLogs.DeleteByTransactionHash(hash)
+	if err != nil {
+		return fmt.Errorf("failed to delete logs of transaction %s: %w", hash, err)
+	}
+
+	err = app.tokenTransfers.DeleteByTransactionHash(hash)
+	if err != nil {
+		return fmt.Errorf("failed to delete token transfers of transaction %s: %w", hash, err)
+	}
+
+	if data != nil && !data.Pending {
+		result, err := app.storeTransaction(hash, data)
+		if err != nil {
+			return err
+		}
+		if result.err != nil {
+			return errors.New(result.err.Message)
+		}
+
+		app.logger.Warn("transaction moved by reorg", "hash", hash, "oldBlockHash", tx.BlockHash, "newBlockHash", result.tx.BlockHash)
+		return nil
+	}
+
+	err = app.transactions.Delete(hash)
+	if err != nil {
+		return fmt.Errorf("failed to delete transaction %s: %w", hash, err)
+	}
+
+	// A transaction that went back to the mempool is tracked as pending again.
+	if data != nil {
+		_, err := app.storeTransaction(hash, data)
+		if err != nil {
+			return err
+		}
+	}
+
+	app.logger.Warn("transaction removed by reorg", "hash", hash, "blockHash", tx.BlockHash, "pending", data != nil)
+	return nil
+}
+
+// setConfirmations sets the number of confirmations of transactions from the
+// current head. If the head cannot be fetched confirmations are left null.
+func (app *application) setConfirmations(ctx context.Context, transactions []*models.Transaction) {
+	if len(transactions) == 0 {
+		return
+	}
+
+	head, err := app.ethClient.BlockNumber(ctx)
+	if err != nil {
+		app.logger.Warn("failed to get the latest block number for confirmations", "error", err)
+		return
+	}
+
+	for _, tx := range transactions {
+		var confirmations uint64
+		if head >= tx.BlockNumber {
+			confirmations = head - tx.BlockNumber + 1
+		}
+		tx.Confirmations = &confirmations
+	}
+}
@@ -1,85 +1,525 @@
 package main
 
 import (
+	"context"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"strconv"
 	"time"
 
+	"eth-fetcher.ddzhalev.net/internal/models"
+	"eth-fetcher.ddzhalev.net/internal/web3"
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/golang-jwt/jwt"
 )
 
 func (app *application) getEth(w http.ResponseWriter, r *http.Request) {
-	hashStrings, err := handleTransactionHashesQueryString(r)
+	hashStrings, err := handleTransactionHashesQueryString(r, app.config.maxHashesPerRequest)
+	if err != nil {
+		app.invalidHashesError(w, r, err)
+		return
+	}
+
+	app.serveTransactions(w, r, hashStrings)
+}
+
+func (app *application) getEthRlp(w http.ResponseWriter, r *http.Request) {
+	rlpHex := r.PathValue("rlphex")
+	rlpBytes, err := hex.DecodeString(rlpHex)
 	if err != nil {
 		app.clientError(w, http.StatusBadRequest)
 		return
 	}
 
+	var rlpHashes []string
+	err = rlp.DecodeBytes(rlpBytes, &rlpHashes)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	hashStrings, err := validateTransactionHashes(rlpHashes, app.config.maxHashesPerRequest)
+	if err != nil {
+		app.invalidHashesError(w, r, err)
+		return
+	}
+
+	app.serveTransactions(w, r, hashStrings)
+}
+
+// serveTransactions responds with the transactions for hashStrings and their token
+// transfers, including their logs when the includeLogs query parameter is true. Transactions not
+// mined yet are listed under "pendingTransactions", hashes that could not be
+// looked up under "errors", and the status code reflects whether all, some or
+// none of the hashes were found.
+func (app *application) serveTransactions(w http.ResponseWriter, r *http.Request, hashStrings []string) {
 	username, _ := app.validateToken(w, r)
-	transactions, err := app.fetchTransactions(r.Context(), hashStrings)
+	lookup, err := app.fetchTransactions(r.Context(), hashStrings)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
 
+	logErrors, err := app.enrichTransactions(r.Context(), lookup.transactions, r.URL.Query().Get("includeLogs") == "true")
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	lookup.errors = append(lookup.errors, logErrors...)
+
 	if username != "" {
-		err = app.users.InsertTransactionIds(username, extractTransactionIds(transactions))
+		err = app.users.InsertTransactionIds(username, extractTransactionIds(lookup.transactions))
 		if err != nil {
 			app.serverError(w, r, err)
 			return
 		}
 	}
 
-	app.responseJSON(w, r, map[string]interface{}{"transactions": transactions})
+	status := transactionsStatus(len(lookup.transactions)+len(lookup.pending), lookup.errors)
+	app.responseJSONWithStatus(w, r, status, map[string]interface{}{
+		"transactions":        lookup.transactions,
+		"pendingTransactions": lookup.pending,
+		"errors":              lookup.errors,
+	})
 }
 
-func (app *application) getEthRlp(w http.ResponseWriter, r *http.Request) {
-	rlpHex := r.PathValue("rlphex")
-	rlpBytes, err := hex.DecodeString(rlpHex)
+// enrichTransactions attaches confirmations, token transfers and decoded inputs to
+// transactions, and their logs when includeLogs is set. Logs are only loaded for
+// transactions that need them, either to be included or to derive token
+// transfers not indexed yet. Transactions whose logs could not be fetched are
+// returned as per-hash errors.
+func (app *application) enrichTransactions(ctx context.Context, transactions []*models.Transaction, includeLogs bool) ([]*transactionError, error) {
+	app.setConfirmations(ctx, transactions)
+
+	hashes := make([]string, len(transactions))
+	for i, tx := range transactions {
+		hashes[i] = tx.TransactionHash
+	}
+
+	transfers, err := app.tokenTransfers.GetByTransactionHashes(hashes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get token transfers from the DB: %w", err)
+	}
+
+	var needLogs []*models.Transaction
+	for _, tx := range transactions {
+		if includeLogs || (tx.LogsCount > 0 && len(transfers[tx.TransactionHash]) == 0) {
+			needLogs = append(needLogs, tx)
+		}
+	}
+
+	logs, txErrors, err := app.loadTransactionLogs(ctx, needLogs)
+	if err != nil {
+		return nil, err
+	}
+
+	transfers, err = app.loadTokenTransfers(ctx, transfers, logs)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, tx := range transactions {
+		tx.TokenTransfers = transfers[tx.TransactionHash]
+		if includeLogs {
+			tx.Logs = logs[tx.TransactionHash]
+		}
+	}
+
+	return txErrors, app.decodeTransactions(transactions)
+}
+
+func (app *application) getTransactionLogs(w http.ResponseWriter, r *http.Request) {
+	hashString, err := normalizeTransactionHash(r.PathValue("hash"))
+	if err != nil {
+		app.invalidHashesError(w, r, &hashValidationError{rejected: []*transactionError{
+			{Hash: r.PathValue("hash"), Code: errCodeInvalidHash, Message: err.Error()},
+		}})
+		return
+	}
+
+	lookup, err := app.fetchTransactions(r.Context(), []string{hashString})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if len(lookup.transactions) == 0 {
+		app.responseJSONWithStatus(w, r, transactionsStatus(len(lookup.pending), lookup.errors), map[string]interface{}{
+			"logs":   []*models.TransactionLog{},
+			"errors": lookup.errors,
+		})
+		return
+	}
+
+	logs, logErrors, err := app.loadTransactionLogs(r.Context(), lookup.transactions)
 	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if len(logErrors) > 0 {
+		app.responseJSONWithStatus(w, r, transactionsStatus(0, logErrors), map[string]interface{}{
+			"logs":   []*models.TransactionLog{},
+			"errors": logErrors,
+		})
+		return
+	}
+
+	txLogs := logs[lookup.transactions[0].TransactionHash]
+
+	err = app.decodeLogs(txLogs)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.responseJSON(w, r, map[string]interface{}{"logs": txLogs})
+}
+
+func (app *application) postContractABI(w http.ResponseWriter, r *http.Request) {
+	username, err := app.validateToken(w, r)
+	if err != nil {
+		app.clientError(w, http.StatusUnauthorized)
+		return
+	}
+
+	address := r.PathValue("address")
+	if !common.IsHexAddress(address) {
 		app.clientError(w, http.StatusBadRequest)
 		return
 	}
 
-	var hashStrings []string
-	err = rlp.DecodeBytes(rlpBytes, &hashStrings)
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
 	if err != nil {
-		app.serverError(w, r, fmt.Errorf("failed to decode RLP data: %w", err))
+		app.clientError(w, http.StatusBadRequest)
 		return
 	}
 
-	username, _ := app.validateToken(w, r)
-	transactions, err := app.fetchTransactions(r.Context(), hashStrings)
+	_, err = web3.ParseABI(string(body))
 	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	contractABI := &models.ContractABI{
+		Address:    common.HexToAddress(address).Hex(),
+		ABI:        string(body),
+		UploadedBy: username,
+	}
+
+	err = app.contractABIs.Upsert(contractABI)
+	if err != nil {
+		if err.Error() == "contract ABI uploaded by another user" {
+			app.clientError(w, http.StatusForbidden)
+			return
+		}
 		app.serverError(w, r, err)
 		return
 	}
 
-	if username != "" {
-		err = app.users.InsertTransactionIds(username, extractTransactionIds(transactions))
+	app.responseJSONWithStatus(w, r, http.StatusCreated, contractABI)
+}
+
+func (app *application) getAll(w http.ResponseWriter, r *http.Request) {
+	q, err := parseTransactionQuery(r)
+	if err != nil {
+		app.responseJSONWithStatus(w, r, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	app.serveTransactionPage(w, r, q, nil)
+}
+
+// serveTransactionPage responds with one page of stored transactions and sets
+// X-Total-Count to the number of transactions matching the filters. fields, if
+// not nil, are sent alongside the page.
+func (app *application) serveTransactionPage(w http.ResponseWriter, r *http.Request, q *models.TransactionQuery, fields map[string]interface{}) {
+	page, err := app.transactions.Find(q)
+	if errors.Is(err, models.ErrInvalidCursor) {
+		app.responseJSONWithStatus(w, r, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	total, err := app.transactions.Count(q)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.setConfirmations(r.Context(), page.Transactions)
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	if fields == nil {
+		app.responseJSON(w, r, page)
+		return
+	}
+
+	fields["transactions"] = page.Transactions
+	if page.NextCursor != "" {
+		fields["nextCursor"] = page.NextCursor
+	}
+	app.responseJSON(w, r, fields)
+}
+
+// getAddress responds with the stored transactions of an address together with
+// its balance and nonce. If the node cannot be reached those are null and the
+// reason is listed under "errors".
+func (app *application) getAddress(w http.ResponseWriter, r *http.Request) {
+	address := r.PathValue("address")
+	if !common.IsHexAddress(address) {
+		app.responseJSONWithStatus(w, r, http.StatusBadRequest, map[string]interface{}{"error": "invalid address"})
+		return
+	}
+
+	q, err := parseTransactionQuery(r)
+	if err != nil {
+		app.responseJSONWithStatus(w, r, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	q.Address = common.HexToAddress(address).Hex()
+
+	fields := map[string]interface{}{"address": q.Address}
+	nodeErrors := make(map[string]string)
+
+	balance, err := app.ethClient.BalanceAt(r.Context(), common.HexToAddress(q.Address), nil)
+	if err != nil {
+		app.logger.Warn("failed to fetch balance", "address", q.Address, "error", err)
+		fields["balance"] = nil
+		nodeErrors["balance"] = err.Error()
+	} else {
+		fields["balance"] = balance.String()
+	}
+
+	nonce, err := app.ethClient.NonceAt(r.Context(), common.HexToAddress(q.Address), nil)
+	if err != nil {
+		app.logger.Warn("failed to fetch nonce", "address", q.Address, "error", err)
+		fields["nonce"] = nil
+		nodeErrors["nonce"] = err.Error()
+	} else {
+		fields["nonce"] = nonce
+	}
+
+	if len(nodeErrors) > 0 {
+		fields["errors"] = nodeErrors
+	}
+
+	app.serveTransactionPage(w, r, q, fields)
+}
+
+func (app *application) getBlock(w http.ResponseWriter, r *http.Request) {
+	summary, err := app.fetchBlock(r.Context(), r.PathValue("numberOrHash"))
+	if errors.Is(err, errInvalidBlockID) {
+		app.responseJSONWithStatus(w, r, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, ethereum.NotFound) {
+		app.responseJSONWithStatus(w, r, http.StatusNotFound, map[string]interface{}{"error": "block not found"})
+		return
+	}
+	if err != nil {
+		app.serverError(w, r, fmt.Errorf("failed to fetch block %s: %w", r.PathValue("numberOrHash"), err))
+		return
+	}
+
+	response := map[string]interface{}{"block": mapBlockSummary(summary)}
+
+	if r.URL.Query().Get("includeTransactions") == "true" {
+		lookup, err := app.fetchTransactions(r.Context(), blockTransactionHashes(summary))
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		logErrors, err := app.enrichTransactions(r.Context(), lookup.transactions, r.URL.Query().Get("includeLogs") == "true")
 		if err != nil {
 			app.serverError(w, r, err)
 			return
 		}
+		lookup.errors = append(lookup.errors, logErrors...)
+
+		response["transactions"] = lookup.transactions
+		response["errors"] = lookup.errors
 	}
 
-	app.responseJSON(w, r, map[string]interface{}{"transactions": transactions})
+	app.responseJSON(w, r, response)
 }
 
-func (app *application) getAll(w http.ResponseWriter, r *http.Request) {
-	transactions, err := app.transactions.GetAll()
+func (app *application) postIngest(w http.ResponseWriter, r *http.Request) {
+	username, err := app.validateToken(w, r)
+	if err != nil {
+		app.clientError(w, http.StatusUnauthorized)
+		return
+	}
+
+	var blockRange struct {
+		FromBlock *uint64 `json:"fromBlock"`
+		ToBlock   *uint64 `json:"toBlock"`
+	}
+
+	err = json.NewDecoder(r.Body).Decode(&blockRange)
+	if err != nil || blockRange.FromBlock == nil || blockRange.ToBlock == nil {
+		app.responseJSONWithStatus(w, r, http.StatusBadRequest, map[string]interface{}{"error": "fromBlock and toBlock are required"})
+		return
+	}
+
+	fromBlock, toBlock := *blockRange.FromBlock, *blockRange.ToBlock
+	if fromBlock > toBlock {
+		app.responseJSONWithStatus(w, r, http.StatusBadRequest, map[string]interface{}{"error": "fromBlock must not be greater than toBlock"})
+		return
+	}
+	if toBlock-fromBlock >= uint64(app.config.maxIngestBlocks) {
+		app.responseJSONWithStatus(w, r, http.StatusBadRequest, map[string]interface{}{
+			"error": fmt.Sprintf("at most %d blocks can be ingested per job", app.config.maxIngestBlocks),
+		})
+		return
+	}
+
+	job := &models.IngestJob{
+		FromBlock: fromBlock,
+		ToBlock:   toBlock,
+		Status:    models.IngestStatusRunning,
+		CreatedBy: username,
+	}
+
+	err = app.ingestJobs.Insert(job)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
 
-	err = json.NewEncoder(w).Encode(map[string]interface{}{"transactions": transactions})
+	app.startIngestJob(job)
+
+	app.responseJSONWithStatus(w, r, http.StatusAccepted, job)
+}
+
+func (app *application) getIngestJob(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	job, err := app.ingestJobs.Get(id)
 	if err != nil {
+		if err.Error() == "ingest job not found" {
+			app.clientError(w, http.StatusNotFound)
+			return
+		}
 		app.serverError(w, r, err)
+		return
 	}
+
+	app.responseJSON(w, r, job)
+}
+
+// postCancelIngestJob stops a running ingest job started by the caller and
+// responds with the job once it has stopped.
+func (app *application) postCancelIngestJob(w http.ResponseWriter, r *http.Request) {
+	username, err := app.validateToken(w, r)
+	if err != nil {
+		app.clientError(w, http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	job, err := app.ingestJobs.Get(id)
+	if err != nil {
+		if err.Error() == "ingest job not found" {
+			app.clientError(w, http.StatusNotFound)
+			return
+		}
+		app.serverError(w, r, err)
+		return
+	}
+
+	if job.CreatedBy != username {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	done, ok := app.ingestRunner.cancel(id)
+	if !ok {
+		app.responseJSONWithStatus(w, r, http.StatusConflict, map[string]interface{}{"error": "ingest job is not running"})
+		return
+	}
+
+	select {
+	case <-done:
+	case <-r.Context().Done():
+		return
+	}
+
+	job, err = app.ingestJobs.Get(id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.responseJSON(w, r, job)
+}
+
+func (app *application) getIndexerStatus(w http.ResponseWriter, r *http.Request) {
+	watchedAddresses := make([]string, len(app.config.indexerAddresses))
+	for i, address := range app.config.indexerAddresses {
+		watchedAddresses[i] = address.Hex()
+	}
+
+	headBlock, lastProcessedBlock, lastError := app.indexer.snapshot()
+
+	var lag *uint64
+	if headBlock != nil && lastProcessedBlock != nil && *headBlock >= *lastProcessedBlock {
+		blocksBehind := *headBlock - *lastProcessedBlock
+		lag = &blocksBehind
+	}
+
+	app.responseJSON(w, r, map[string]interface{}{
+		"enabled":            app.config.indexerEnabled,
+		"watchedAddresses":   watchedAddresses,
+		"headBlock":          headBlock,
+		"lastProcessedBlock": lastProcessedBlock,
+		"lag":                lag,
+		"lastError":          lastError,
+	})
+}
+
+// getHealth reports whether the database is reachable and the event listener is
+// live, responding with 503 Service Unavailable when either is not.
+func (app *application) getHealth(w http.ResponseWriter, r *http.Request) {
+	status := http.StatusOK
+
+	database := "ok"
+	err := app.transactions.DB.PingContext(r.Context())
+	if err != nil {
+		database = err.Error()
+		status = http.StatusServiceUnavailable
+	}
+
+	listener := app.eventListenerHealth.Status()
+	if listener.State != web3.ListenerStateLive {
+		status = http.StatusServiceUnavailable
+	}
+
+	app.responseJSONWithStatus(w, r, status, map[string]interface{}{
+		"status":        http.StatusText(status),
+		"database":      database,
+		"eventListener": listener,
+	})
 }
 
 func (app *application) postAuth(w http.ResponseWriter, r *http.Request) {
@@ -134,10 +574,17 @@ func (app *application) getMy(w http.ResponseWriter, r *http.Request) {
 
 	transactions, _ := app.transactions.GetMultipleByIDs(user.SearchedTransactionIds)
 
+	app.setConfirmations(r.Context(), transactions)
+
 	app.responseJSON(w, r, map[string]interface{}{"transactions": transactions})
 }
 
+// postSavePerson submits a setPersonInfo transaction and responds with 202
+// Accepted as soon as it is sent. Its progress is tracked in the background and
+// reported by getSavePersonStatus.
 func (app *application) postSavePerson(w http.ResponseWriter, r *http.Request) {
+	username, _ := app.validateToken(w, r)
+
 	var person struct {
 		Name string `json:"name"`
 		Age  int    `json:"age"`
@@ -149,20 +596,119 @@ func (app *application) postSavePerson(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	txHash, txStatus, err := app.contractInteractor.SetPersonInfo(person.Name, person.Age)
+	arguments, err := json.Marshal(person)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
 
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"txHash":   txHash,
-		"txStatus": txStatus,
+	// The transaction is stored before it is sent, so that once it is sent the
+	// request cannot fail and leave it untracked.
+	var outgoingTx *models.OutgoingTransaction
+	_, err = app.contractInteractor.SubmitPersonInfo(person.Name, person.Age, func(ethTx *types.Transaction) error {
+		outgoingTx = app.newOutgoingTransaction(ethTx, "setPersonInfo", arguments, username)
+		return app.outgoingTransactions.Insert(outgoingTx)
 	})
+	if err != nil {
+		if outgoingTx != nil && outgoingTx.ID != 0 {
+			deleteErr := app.outgoingTransactions.Delete(outgoingTx.TransactionHash)
+			if deleteErr != nil {
+				app.logger.Error("failed to delete unsent outgoing transaction", "hash", outgoingTx.TransactionHash, "error", deleteErr)
+			}
+		}
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.responseJSONWithStatus(w, r, http.StatusAccepted, outgoingTransactionResponse(outgoingTx))
+}
+
+func (app *application) getSavePersonStatus(w http.ResponseWriter, r *http.Request) {
+	hashString, err := normalizeTransactionHash(r.PathValue("txHash"))
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	outgoingTx, err := app.outgoingTransactions.Get(hashString)
+	if err != nil {
+		if err.Error() == "outgoing transaction not found" {
+			app.clientError(w, http.StatusNotFound)
+			return
+		}
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.responseJSON(w, r, outgoingTx)
+}
+
+// postSpeedUpSavePerson re-sends a pending setPersonInfo transaction with the
+// same nonce and higher fees.
+func (app *application) postSpeedUpSavePerson(w http.ResponseWriter, r *http.Request) {
+	app.serveReplacement(w, r, false)
+}
+
+// postCancelSavePerson replaces a pending setPersonInfo transaction with a
+// zero-value transfer to the sender, using the same nonce and higher fees.
+func (app *application) postCancelSavePerson(w http.ResponseWriter, r *http.Request) {
+	app.serveReplacement(w, r, true)
+}
+
+func (app *application) serveReplacement(w http.ResponseWriter, r *http.Request, cancel bool) {
+	username, err := app.validateToken(w, r)
+	if err != nil {
+		app.clientError(w, http.StatusUnauthorized)
+		return
+	}
+
+	hashString, err := normalizeTransactionHash(r.PathValue("txHash"))
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	outgoingTx, err := app.outgoingTransactions.Get(hashString)
+	if err != nil {
+		if err.Error() == "outgoing transaction not found" {
+			app.clientError(w, http.StatusNotFound)
+			return
+		}
+		app.serverError(w, r, err)
+		return
+	}
+
+	if outgoingTx.Status != models.OutgoingStatusSubmitted && outgoingTx.Status != models.OutgoingStatusTimedOut {
+		app.responseJSONWithStatus(w, r, http.StatusConflict, map[string]interface{}{
+			"error": fmt.Sprintf("transaction is already %s", outgoingTx.Status),
+		})
+		return
+	}
+
+	replacement, err := app.replaceOutgoingTransaction(r.Context(), outgoingTx, cancel, username)
+	if err != nil {
+		switch {
+		case errors.Is(err, web3.ErrFeeCeilingExceeded), errors.Is(err, errInputNotStored), errors.Is(err, errReplacementClaimed):
+			app.responseJSONWithStatus(w, r, http.StatusConflict, map[string]interface{}{"error": err.Error()})
+		case web3.IsNonceTooLow(err):
+			app.responseJSONWithStatus(w, r, http.StatusConflict, map[string]interface{}{"error": "the transaction nonce was already used"})
+		case web3.IsUnderpriced(err):
+			app.responseJSONWithStatus(w, r, http.StatusConflict, map[string]interface{}{
+				"error": "the node rejected the replacement as underpriced, a bigger REPLACEMENT_FEE_BUMP_PERCENT is needed",
+			})
+		case web3.IsAlreadyKnown(err):
+			app.responseJSONWithStatus(w, r, http.StatusConflict, map[string]interface{}{"error": "the node already has this replacement transaction"})
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.responseJSONWithStatus(w, r, http.StatusAccepted, outgoingTransactionResponse(replacement))
 }
 
 func (app *application) getPersonList(w http.ResponseWriter, r *http.Request) {
-	persons, err := app.personInfoEvents.GetAll()
+	persons, err := app.personInfoEvents.GetPersons()
 
 	if err != nil {
 		app.serverError(w, r, err)
@@ -174,3 +720,44 @@ func (app *application) getPersonList(w http.ResponseWriter, r *http.Request) {
 		app.serverError(w, r, err)
 	}
 }
+
+func (app *application) getPerson(w http.ResponseWriter, r *http.Request) {
+	personIndex, err := strconv.Atoi(r.PathValue("index"))
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	person, err := app.personInfoEvents.GetPerson(personIndex)
+	if err != nil {
+		if err.Error() == "person not found" {
+			app.clientError(w, http.StatusNotFound)
+			return
+		}
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.responseJSON(w, r, person)
+}
+
+func (app *application) getPersonHistory(w http.ResponseWriter, r *http.Request) {
+	personIndex, err := strconv.Atoi(r.PathValue("index"))
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	history, err := app.personInfoEvents.GetHistory(personIndex)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if len(history) == 0 {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	app.responseJSON(w, r, map[string]interface{}{"history": history})
+}
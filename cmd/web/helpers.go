@@ -1,23 +1,35 @@
 package main
 
 import (
-	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"math/big"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 
 	"eth-fetcher.ddzhalev.net/internal/models"
+	"eth-fetcher.ddzhalev.net/internal/web3"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/golang-jwt/jwt"
 )
 
-func handleTransactionHashesQueryString(r *http.Request) ([]string, error) {
+// hashValidationError lists the transaction hash inputs rejected by validateTransactionHashes.
+type hashValidationError struct {
+	rejected []*transactionError
+}
+
+func (e *hashValidationError) Error() string {
+	return fmt.Sprintf("%d invalid transaction hashes", len(e.rejected))
+}
+
+func handleTransactionHashesQueryString(r *http.Request, maxHashes int) ([]string, error) {
 	transactionHashes := r.URL.Query()["transactionHashes"]
 	if len(transactionHashes) == 0 {
 		return nil, fmt.Errorf("missing transactionHashes parameter")
@@ -28,110 +40,369 @@ func handleTransactionHashesQueryString(r *http.Request) ([]string, error) {
 		flattenedHashes = append(flattenedHashes, strings.Split(hash, ",")...)
 	}
 
+	return validateTransactionHashes(flattenedHashes, maxHashes)
+}
+
+// validateTransactionHashes trims, validates, lowercases and deduplicates the
+// given hashes. Invalid inputs are reported together in a *hashValidationError.
+func validateTransactionHashes(hashStrings []string, maxHashes int) ([]string, error) {
 	uniqueHashes := make(map[string]bool)
 	var result []string
-	for _, hash := range flattenedHashes {
-		if hash = strings.TrimSpace(hash); hash != "" {
-			if !uniqueHashes[hash] {
-				uniqueHashes[hash] = true
-				result = append(result, hash)
-			}
+	var rejected []*transactionError
+	for _, hash := range hashStrings {
+		hash = strings.TrimSpace(hash)
+		if hash == "" {
+			continue
 		}
+
+		normalized, err := normalizeTransactionHash(hash)
+		if err != nil {
+			rejected = append(rejected, &transactionError{Hash: hash, Code: errCodeInvalidHash, Message: err.Error()})
+			continue
+		}
+
+		if !uniqueHashes[normalized] {
+			uniqueHashes[normalized] = true
+			result = append(result, normalized)
+		}
+	}
+
+	if len(rejected) > 0 {
+		return nil, &hashValidationError{rejected: rejected}
 	}
 
 	if len(result) == 0 {
 		return nil, fmt.Errorf("no valid transaction hashes provided")
 	}
 
+	if maxHashes > 0 && len(result) > maxHashes {
+		return nil, fmt.Errorf("too many transaction hashes: got %d, maximum is %d", len(result), maxHashes)
+	}
+
 	return result, nil
 }
 
-func mapTransactionToModel(ethTx *types.Transaction, receipt *types.Receipt, blockHeader *types.Header) (*models.Transaction, error) {
+// normalizeTransactionHash checks that hash is a 0x-prefixed 32-byte hex string
+// and returns it in lowercase.
+func normalizeTransactionHash(hash string) (string, error) {
+	if !strings.HasPrefix(hash, "0x") && !strings.HasPrefix(hash, "0X") {
+		return "", fmt.Errorf("missing 0x prefix")
+	}
+
+	digits := hash[2:]
+	if len(digits) != 2*common.HashLength {
+		return "", fmt.Errorf("expected %d hex characters, got %d", 2*common.HashLength, len(digits))
+	}
+
+	if _, err := hex.DecodeString(digits); err != nil {
+		return "", fmt.Errorf("contains non-hex characters")
+	}
+
+	return "0x" + strings.ToLower(digits), nil
+}
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// parseTransactionQuery reads the pagination, filter and sort parameters shared
+// by the transaction listing endpoints.
+func parseTransactionQuery(r *http.Request) (*models.TransactionQuery, error) {
+	params := r.URL.Query()
+	q := &models.TransactionQuery{
+		Cursor: params.Get("cursor"),
+		Limit:  defaultPageSize,
+	}
+
+	if limit := params.Get("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil || value < 1 || value > maxPageSize {
+			return nil, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+		}
+		q.Limit = value
+	}
+
+	for name, target := range map[string]*string{"from": &q.From, "to": &q.To, "contractAddress": &q.ContractAddress} {
+		if value := params.Get(name); value != "" {
+			if !common.IsHexAddress(value) {
+				return nil, fmt.Errorf("%s must be an address", name)
+			}
+			*target = common.HexToAddress(value).Hex()
+		}
+	}
+
+	for name, target := range map[string]**uint64{"fromBlock": &q.FromBlock, "toBlock": &q.ToBlock} {
+		if value := params.Get(name); value != "" {
+			block, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s must be a block number", name)
+			}
+			*target = &block
+		}
+	}
+	if q.FromBlock != nil && q.ToBlock != nil && *q.FromBlock > *q.ToBlock {
+		return nil, fmt.Errorf("fromBlock must not be after toBlock")
+	}
+
+	if value := params.Get("status"); value != "" {
+		status, err := strconv.Atoi(value)
+		if err != nil || (status != 0 && status != 1) {
+			return nil, fmt.Errorf("status must be 0 or 1")
+		}
+		q.Status = &status
+	}
+
+	sort := params.Get("sort")
+	if strings.HasPrefix(sort, "-") {
+		q.Descending = true
+		sort = sort[1:]
+	}
+	switch sort {
+	case "", models.SortByID:
+		q.SortBy = models.SortByID
+	case models.SortByBlockNumber:
+		q.SortBy = models.SortByBlockNumber
+	default:
+		return nil, fmt.Errorf("sort must be one of id, -id, blockNumber, -blockNumber")
+	}
+
+	return q, nil
+}
+
+func isTransactionHash(hashString string) bool {
+	hashBytes, err := hexutil.Decode(hashString)
+	return err == nil && len(hashBytes) == common.HashLength
+}
+
+// parseAddressList parses a comma-separated list of hex addresses. Empty entries are ignored.
+func parseAddressList(list string) ([]common.Address, error) {
+	var addresses []common.Address
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !common.IsHexAddress(entry) {
+			return nil, fmt.Errorf("%q is not a hex address", entry)
+		}
+		addresses = append(addresses, common.HexToAddress(entry))
+	}
+	return addresses, nil
+}
+
+// transactionsStatus picks the response status of a multi-hash lookup: 200 when
+// every hash was found, 207 on partial success, and otherwise a status derived
+// from the kind of errors that occurred. 502 is only used when the node failed
+// to answer for some hash; 400 when every hash was invalid, and 404 otherwise.
+func transactionsStatus(found int, txErrors []*transactionError) int {
+	if len(txErrors) == 0 {
+		return http.StatusOK
+	}
+
+	if found > 0 {
+		return http.StatusMultiStatus
+	}
+
+	allInvalid := true
+	for _, txErr := range txErrors {
+		switch txErr.Code {
+		case errCodeInvalidHash:
+		case errCodeNotFound, errCodePending:
+			allInvalid = false
+		default:
+			return http.StatusBadGateway
+		}
+	}
+
+	if allInvalid {
+		return http.StatusBadRequest
+	}
+	return http.StatusNotFound
+}
+
+func mapTransactionToModel(ethTx *types.Transaction, receipt *types.Receipt, blockHeader *types.Header, chainID *big.Int) (*models.Transaction, error) {
 	value := ethTx.Value().String()
 
-	fromAddress, err := types.Sender(types.NewLondonSigner(ethTx.ChainId()), ethTx)
+	fromAddress, err := types.Sender(web3.BlockSigner(chainID, blockHeader), ethTx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to extract sender address: %w", err)
 	}
 
+	var toAddress *string
+	if ethTx.To() != nil {
+		to := ethTx.To().Hex()
+		toAddress = &to
+	}
+
 	var contractAddress string
 	if receipt.ContractAddress != (common.Address{}) {
 		contractAddress = receipt.ContractAddress.Hex()
 	}
 
+	maxFeePerGas, maxPriorityFeePerGas := dynamicFeeCaps(ethTx)
+
+	gasPrice := effectiveGasPrice(ethTx, receipt, blockHeader)
+	fee := new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(receipt.GasUsed))
+	if receipt.BlobGasPrice != nil {
+		fee.Add(fee, new(big.Int).Mul(receipt.BlobGasPrice, new(big.Int).SetUint64(receipt.BlobGasUsed)))
+	}
+
 	return &models.Transaction{
-		TransactionHash:   ethTx.Hash().Hex(),
-		TransactionStatus: int(receipt.Status),
-		BlockHash:         blockHeader.Hash().Hex(),
-		BlockNumber:       blockHeader.Number.Uint64(),
-		From:              fromAddress.Hex(),
-		To:                ethTx.To().Hex(),
-		ContractAddress:   contractAddress,
-		LogsCount:         len(receipt.Logs),
-		Input:             common.Bytes2Hex(ethTx.Data()),
-		Value:             value,
+		TransactionHash:      ethTx.Hash().Hex(),
+		TransactionStatus:    int(receipt.Status),
+		BlockHash:            receipt.BlockHash.Hex(),
+		BlockNumber:          blockHeader.Number.Uint64(),
+		From:                 fromAddress.Hex(),
+		To:                   toAddress,
+		ContractAddress:      contractAddress,
+		LogsCount:            len(receipt.Logs),
+		Input:                common.Bytes2Hex(ethTx.Data()),
+		Value:                value,
+		Type:                 int(ethTx.Type()),
+		Nonce:                ethTx.Nonce(),
+		TransactionIndex:     receipt.TransactionIndex,
+		GasLimit:             ethTx.Gas(),
+		GasUsed:              receipt.GasUsed,
+		CumulativeGasUsed:    receipt.CumulativeGasUsed,
+		EffectiveGasPrice:    gasPrice.String(),
+		MaxFeePerGas:         maxFeePerGas,
+		MaxPriorityFeePerGas: maxPriorityFeePerGas,
+		Fee:                  fee.String(),
+		BlockTimestamp:       blockHeader.Time,
+		AuthorizationList:    mapAuthorizationsToModel(ethTx.SetCodeAuthorizations()),
 	}, nil
 }
 
-func (app *application) responseJSON(w http.ResponseWriter, r *http.Request, data interface{}) {
-	err := json.NewEncoder(w).Encode(data)
-	if err != nil {
-		app.serverError(w, r, fmt.Errorf("failed to encode response: %w", err))
+// dynamicFeeCaps returns the fee cap and tip cap of a dynamic fee transaction,
+// or nils for transaction types that only have a gas price.
+func dynamicFeeCaps(ethTx *types.Transaction) (*string, *string) {
+	if ethTx.Type() < types.DynamicFeeTxType {
+		return nil, nil
 	}
+	feeCap, tipCap := ethTx.GasFeeCap().String(), ethTx.GasTipCap().String()
+	return &feeCap, &tipCap
 }
 
-func (app *application) fetchTransactions(ctx context.Context, hashStrings []string) ([]*models.Transaction, error) {
-	var transactions []*models.Transaction
-	for _, hashString := range hashStrings {
-		tx, err := app.fetchAndStoreTransaction(ctx, hashString)
-		if err != nil {
-			return nil, err
-		}
-		transactions = append(transactions, tx)
+// effectiveGasPrice returns the price per gas paid by the transaction, computing
+// it from the block base fee for nodes that omit it from the receipt.
+func effectiveGasPrice(ethTx *types.Transaction, receipt *types.Receipt, blockHeader *types.Header) *big.Int {
+	if receipt.EffectiveGasPrice != nil {
+		return receipt.EffectiveGasPrice
 	}
-	return transactions, nil
-}
 
-func (app *application) fetchAndStoreTransaction(ctx context.Context, hashString string) (*models.Transaction, error) {
-	tx, err := app.transactions.Get(hashString)
-	if err == nil {
-		return tx, nil
+	if blockHeader.BaseFee == nil {
+		return ethTx.GasPrice()
 	}
 
-	if err.Error() != "transaction not found" {
-		return nil, fmt.Errorf("failed to get transaction %s from the DB: %w", hashString, err)
+	price := new(big.Int).Add(blockHeader.BaseFee, ethTx.EffectiveGasTipValue(blockHeader.BaseFee))
+	if price.Cmp(ethTx.GasFeeCap()) > 0 {
+		return ethTx.GasFeeCap()
 	}
+	return price
+}
 
-	ethTx, isPending, err := app.ethClient.TransactionByHash(ctx, common.HexToHash(hashString))
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch transaction %s: %w", hashString, err)
+// mapAuthorizationsToModel returns the authorization list of a set-code
+// transaction, recovering the authority that signed each authorization.
+func mapAuthorizationsToModel(authorizations []types.SetCodeAuthorization) []*models.SetCodeAuthorization {
+	result := make([]*models.SetCodeAuthorization, len(authorizations))
+	for i, auth := range authorizations {
+		result[i] = &models.SetCodeAuthorization{
+			ChainID: auth.ChainID.Dec(),
+			Address: auth.Address.Hex(),
+			Nonce:   auth.Nonce,
+		}
+		if authority, err := auth.Authority(); err == nil {
+			hex := authority.Hex()
+			result[i].Authority = &hex
+		}
 	}
+	return result
+}
+
+func mapLogsToModel(logs []*types.Log) []*models.TransactionLog {
+	result := make([]*models.TransactionLog, len(logs))
+	for i, log := range logs {
+		topics := make([]string, len(log.Topics))
+		for j, topic := range log.Topics {
+			topics[j] = topic.Hex()
+		}
 
-	if isPending {
-		return nil, fmt.Errorf("transaction %s is still pending", hashString)
+		result[i] = &models.TransactionLog{
+			TransactionHash: log.TxHash.Hex(),
+			LogIndex:        log.Index,
+			Address:         log.Address.Hex(),
+			Topics:          topics,
+			Data:            hexutil.Encode(log.Data),
+			Removed:         log.Removed,
+		}
 	}
+	return result
+}
 
-	receipt, err := app.ethClient.TransactionReceipt(ctx, ethTx.Hash())
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch receipt for transaction %s: %w", hashString, err)
+func mapTokenTransfersToModel(logs []*models.TransactionLog) []*models.TokenTransfer {
+	var transfers []*models.TokenTransfer
+	for _, log := range logs {
+		topics := make([]common.Hash, len(log.Topics))
+		for i, topic := range log.Topics {
+			topics[i] = common.HexToHash(topic)
+		}
+
+		transfer, err := web3.ParseTokenTransfer(common.HexToAddress(log.Address), topics, common.FromHex(log.Data))
+		if err != nil {
+			continue
+		}
+
+		transfer.TransactionHash = log.TransactionHash
+		transfer.LogIndex = log.LogIndex
+		transfers = append(transfers, transfer)
 	}
+	return transfers
+}
 
-	blockHeader, err := app.ethClient.HeaderByHash(ctx, receipt.BlockHash)
+func mapPendingTransactionToModel(ethTx *types.Transaction, chainID *big.Int) (*models.PendingTransaction, error) {
+	fromAddress, err := types.Sender(types.LatestSignerForChainID(chainID), ethTx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch block header for transaction %s: %w", hashString, err)
+		return nil, fmt.Errorf("failed to extract sender address: %w", err)
 	}
 
-	tx, err = mapTransactionToModel(ethTx, receipt, blockHeader)
-	if err != nil {
-		return nil, fmt.Errorf("failed to convert transaction %s: %w", hashString, err)
+	var toAddress *string
+	if ethTx.To() != nil {
+		to := ethTx.To().Hex()
+		toAddress = &to
 	}
 
-	err = app.transactions.Insert(tx)
+	return &models.PendingTransaction{
+		TransactionHash:      ethTx.Hash().Hex(),
+		Status:               models.PendingStatusPending,
+		From:                 fromAddress.Hex(),
+		To:                   toAddress,
+		Nonce:                ethTx.Nonce(),
+		Gas:                  ethTx.Gas(),
+		GasPrice:             ethTx.GasPrice().String(),
+		MaxFeePerGas:         ethTx.GasFeeCap().String(),
+		MaxPriorityFeePerGas: ethTx.GasTipCap().String(),
+		Input:                common.Bytes2Hex(ethTx.Data()),
+		Value:                ethTx.Value().String(),
+	}, nil
+}
+
+func (app *application) responseJSON(w http.ResponseWriter, r *http.Request, data interface{}) {
+	app.responseJSONWithStatus(w, r, http.StatusOK, data)
+}
+
+// responseJSONWithStatus encodes data before writing the header, so an encoding
+// failure can still be reported as a server error.
+func (app *application) responseJSONWithStatus(w http.ResponseWriter, r *http.Request, status int, data interface{}) {
+	body, err := json.Marshal(data)
 	if err != nil {
-		return nil, fmt.Errorf("failed to insert transaction %s: %w", hashString, err)
+		app.serverError(w, r, fmt.Errorf("failed to encode response: %w", err))
+		return
 	}
 
-	return tx, nil
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(body, '\n'))
 }
 
 func extractTransactionIds(transactions []*models.Transaction) []int {
@@ -0,0 +1,436 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"eth-fetcher.ddzhalev.net/internal/web3"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/holiman/uint256"
+)
+
+const gwei = params.GWei
+
+// fixtureHeader is a mainnet block after the Prague fork, so every transaction
+// type, including EIP-7702 set-code transactions, is valid in it.
+func fixtureHeader() *types.Header {
+	return &types.Header{
+		Number:  big.NewInt(22_500_000),
+		Time:    1_748_000_000,
+		BaseFee: big.NewInt(10 * gwei),
+	}
+}
+
+type transactionFixture struct {
+	name string
+	// sign returns the signed fixture for chainID.
+	sign func(t *testing.T, key *ecdsa.PrivateKey, chainID *big.Int) *types.Transaction
+	// receipt completes the fixture receipt for the transaction type.
+	receipt func(receipt *types.Receipt)
+
+	wantType              uint8
+	wantAuthorizations    int
+	wantCreation          bool
+	wantMaxFees           bool
+	wantEffectiveGasPrice *big.Int
+	wantFee               *big.Int
+}
+
+var fixtureTo = common.HexToAddress("0xf321e3770293Bbb920032C5501Cd9A64b223bB9c")
+
+// fixtureDelegate is the contract set-code fixtures delegate to.
+var fixtureDelegate = common.HexToAddress("0x63c0c19a282a1B52b07dD5a65b58948A07DAE32B")
+
+// fixtureAuthorityKey signs the authorizations of set-code fixtures.
+var fixtureAuthorityKey, _ = crypto.HexToECDSA("8a1f9a8f95be41cd7ccb6168179afb4504aefe388d1e14474d32c45c72ce7b7a")
+
+func signAuthorization(t *testing.T, auth types.SetCodeAuthorization) types.SetCodeAuthorization {
+	t.Helper()
+	signed, err := types.SignSetCode(fixtureAuthorityKey, auth)
+	if err != nil {
+		t.Fatalf("failed to sign authorization: %v", err)
+	}
+	return signed
+}
+
+func signFixture(t *testing.T, key *ecdsa.PrivateKey, signer types.Signer, txData types.TxData) *types.Transaction {
+	t.Helper()
+	tx, err := types.SignNewTx(key, signer, txData)
+	if err != nil {
+		t.Fatalf("failed to sign fixture: %v", err)
+	}
+	return tx
+}
+
+func transactionFixtures() []transactionFixture {
+	const gasUsed = 21000
+	fee := func(gasPrice int64) *big.Int {
+		return new(big.Int).Mul(big.NewInt(gasPrice), big.NewInt(gasUsed))
+	}
+
+	return []transactionFixture{
+		{
+			name: "legacy before EIP-155",
+			sign: func(t *testing.T, key *ecdsa.PrivateKey, _ *big.Int) *types.Transaction {
+				return signFixture(t, key, types.HomesteadSigner{}, &types.LegacyTx{
+					Nonce: 1, GasPrice: big.NewInt(20 * gwei), Gas: 21000, To: &fixtureTo, Value: big.NewInt(1),
+				})
+			},
+			wantType:              types.LegacyTxType,
+			wantEffectiveGasPrice: big.NewInt(20 * gwei),
+			wantFee:               fee(20 * gwei),
+		},
+		{
+			name: "legacy with EIP-155",
+			sign: func(t *testing.T, key *ecdsa.PrivateKey, chainID *big.Int) *types.Transaction {
+				return signFixture(t, key, types.NewEIP155Signer(chainID), &types.LegacyTx{
+					Nonce: 2, GasPrice: big.NewInt(20 * gwei), Gas: 21000, To: &fixtureTo, Value: big.NewInt(1),
+				})
+			},
+			wantType:              types.LegacyTxType,
+			wantEffectiveGasPrice: big.NewInt(20 * gwei),
+			wantFee:               fee(20 * gwei),
+		},
+		{
+			name: "access list",
+			sign: func(t *testing.T, key *ecdsa.PrivateKey, chainID *big.Int) *types.Transaction {
+				return signFixture(t, key, types.LatestSignerForChainID(chainID), &types.AccessListTx{
+					ChainID: chainID, Nonce: 3, GasPrice: big.NewInt(15 * gwei), Gas: 30000, To: &fixtureTo,
+					AccessList: types.AccessList{{Address: fixtureTo, StorageKeys: []common.Hash{{1}}}},
+				})
+			},
+			wantType:              types.AccessListTxType,
+			wantEffectiveGasPrice: big.NewInt(15 * gwei),
+			wantFee:               fee(15 * gwei),
+		},
+		{
+			name: "dynamic fee",
+			sign: func(t *testing.T, key *ecdsa.PrivateKey, chainID *big.Int) *types.Transaction {
+				return signFixture(t, key, types.LatestSignerForChainID(chainID), &types.DynamicFeeTx{
+					ChainID: chainID, Nonce: 4, GasTipCap: big.NewInt(2 * gwei), GasFeeCap: big.NewInt(30 * gwei), Gas: 30000, To: &fixtureTo,
+				})
+			},
+			wantType:              types.DynamicFeeTxType,
+			wantMaxFees:           true,
+			wantEffectiveGasPrice: big.NewInt(12 * gwei),
+			wantFee:               fee(12 * gwei),
+		},
+		{
+			name: "dynamic fee with receipt gas price",
+			sign: func(t *testing.T, key *ecdsa.PrivateKey, chainID *big.Int) *types.Transaction {
+				return signFixture(t, key, types.LatestSignerForChainID(chainID), &types.DynamicFeeTx{
+					ChainID: chainID, Nonce: 5, GasTipCap: big.NewInt(2 * gwei), GasFeeCap: big.NewInt(30 * gwei), Gas: 30000, To: &fixtureTo,
+				})
+			},
+			receipt: func(receipt *types.Receipt) {
+				receipt.EffectiveGasPrice = big.NewInt(11 * gwei)
+			},
+			wantType:              types.DynamicFeeTxType,
+			wantMaxFees:           true,
+			wantEffectiveGasPrice: big.NewInt(11 * gwei),
+			wantFee:               fee(11 * gwei),
+		},
+		{
+			name: "blob",
+			sign: func(t *testing.T, key *ecdsa.PrivateKey, chainID *big.Int) *types.Transaction {
+				return signFixture(t, key, types.LatestSignerForChainID(chainID), &types.BlobTx{
+					ChainID:    uint256.MustFromBig(chainID),
+					Nonce:      6,
+					GasTipCap:  uint256.NewInt(2 * gwei),
+					GasFeeCap:  uint256.NewInt(30 * gwei),
+					Gas:        30000,
+					To:         fixtureTo,
+					Value:      uint256.NewInt(0),
+					BlobFeeCap: uint256.NewInt(5 * gwei),
+					BlobHashes: []common.Hash{{0x01}},
+				})
+			},
+			receipt: func(receipt *types.Receipt) {
+				receipt.BlobGasUsed = params.BlobTxBlobGasPerBlob
+				receipt.BlobGasPrice = big.NewInt(3 * gwei)
+			},
+			wantType:              types.BlobTxType,
+			wantMaxFees:           true,
+			wantEffectiveGasPrice: big.NewInt(12 * gwei),
+			wantFee: new(big.Int).Add(fee(12*gwei),
+				new(big.Int).Mul(big.NewInt(3*gwei), big.NewInt(params.BlobTxBlobGasPerBlob))),
+		},
+		{
+			name: "set code",
+			sign: func(t *testing.T, key *ecdsa.PrivateKey, chainID *big.Int) *types.Transaction {
+				return signFixture(t, key, types.LatestSignerForChainID(chainID), &types.SetCodeTx{
+					ChainID:   uint256.MustFromBig(chainID),
+					Nonce:     9,
+					GasTipCap: uint256.NewInt(2 * gwei),
+					GasFeeCap: uint256.NewInt(30 * gwei),
+					Gas:       60000,
+					To:        fixtureTo,
+					Value:     uint256.NewInt(0),
+					AuthList: []types.SetCodeAuthorization{
+						signAuthorization(t, types.SetCodeAuthorization{ChainID: *uint256.MustFromBig(chainID), Address: fixtureDelegate, Nonce: 0}),
+						signAuthorization(t, types.SetCodeAuthorization{Address: fixtureDelegate, Nonce: 1}),
+					},
+				})
+			},
+			wantType:              types.SetCodeTxType,
+			wantAuthorizations:    2,
+			wantMaxFees:           true,
+			wantEffectiveGasPrice: big.NewInt(12 * gwei),
+			wantFee:               fee(12 * gwei),
+		},
+		{
+			name: "legacy contract creation",
+			sign: func(t *testing.T, key *ecdsa.PrivateKey, chainID *big.Int) *types.Transaction {
+				return signFixture(t, key, types.NewEIP155Signer(chainID), &types.LegacyTx{
+					Nonce: 7, GasPrice: big.NewInt(20 * gwei), Gas: 100000, Data: common.FromHex("0x6080604052"),
+				})
+			},
+			wantType:              types.LegacyTxType,
+			wantCreation:          true,
+			wantEffectiveGasPrice: big.NewInt(20 * gwei),
+			wantFee:               fee(20 * gwei),
+		},
+		{
+			name: "dynamic fee contract creation",
+			sign: func(t *testing.T, key *ecdsa.PrivateKey, chainID *big.Int) *types.Transaction {
+				return signFixture(t, key, types.LatestSignerForChainID(chainID), &types.DynamicFeeTx{
+					ChainID: chainID, Nonce: 8, GasTipCap: big.NewInt(2 * gwei), GasFeeCap: big.NewInt(30 * gwei), Gas: 100000,
+					Data: common.FromHex("0x6080604052"),
+				})
+			},
+			wantType:              types.DynamicFeeTxType,
+			wantCreation:          true,
+			wantMaxFees:           true,
+			wantEffectiveGasPrice: big.NewInt(12 * gwei),
+			wantFee:               fee(12 * gwei),
+		},
+	}
+}
+
+func TestMapTransactionToModel(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+
+	// Mainnet resolves its signer from the chain config, the unknown chain falls
+	// back to the latest signer.
+	chains := map[string]*big.Int{
+		"mainnet":       params.MainnetChainConfig.ChainID,
+		"unknown chain": big.NewInt(84532),
+	}
+
+	for chainName, chainID := range chains {
+		for _, fixture := range transactionFixtures() {
+			t.Run(chainName+"/"+fixture.name, func(t *testing.T) {
+				ethTx := fixture.sign(t, key, chainID)
+				header := fixtureHeader()
+				receipt := &types.Receipt{
+					Status:            types.ReceiptStatusSuccessful,
+					GasUsed:           21000,
+					CumulativeGasUsed: 42000,
+					TransactionIndex:  3,
+					BlockHash:         common.HexToHash("0xb10c"),
+					BlockNumber:       header.Number,
+				}
+				if fixture.wantCreation {
+					receipt.ContractAddress = crypto.CreateAddress(sender, ethTx.Nonce())
+				}
+				if fixture.receipt != nil {
+					fixture.receipt(receipt)
+				}
+
+				recovered, err := types.Sender(web3.BlockSigner(chainID, header), ethTx)
+				if err != nil {
+					t.Fatalf("BlockSigner failed to recover the sender: %v", err)
+				}
+				if recovered != sender {
+					t.Fatalf("BlockSigner recovered %s, want %s", recovered.Hex(), sender.Hex())
+				}
+
+				tx, err := mapTransactionToModel(ethTx, receipt, header, chainID)
+				if err != nil {
+					t.Fatalf("mapTransactionToModel failed: %v", err)
+				}
+
+				if tx.From != sender.Hex() {
+					t.Errorf("From = %s, want %s", tx.From, sender.Hex())
+				}
+				if tx.Type != int(fixture.wantType) {
+					t.Errorf("Type = %d, want %d", tx.Type, fixture.wantType)
+				}
+				if tx.TransactionHash != ethTx.Hash().Hex() {
+					t.Errorf("TransactionHash = %s, want %s", tx.TransactionHash, ethTx.Hash().Hex())
+				}
+				if tx.BlockHash != receipt.BlockHash.Hex() {
+					t.Errorf("BlockHash = %s, want the node reported %s", tx.BlockHash, receipt.BlockHash.Hex())
+				}
+
+				if fixture.wantCreation {
+					if tx.To != nil {
+						t.Errorf("To = %s, want nil for a contract creation", *tx.To)
+					}
+					if tx.ContractAddress != receipt.ContractAddress.Hex() {
+						t.Errorf("ContractAddress = %q, want %s", tx.ContractAddress, receipt.ContractAddress.Hex())
+					}
+				} else {
+					if tx.To == nil || *tx.To != fixtureTo.Hex() {
+						t.Errorf("To = %v, want %s", tx.To, fixtureTo.Hex())
+					}
+					if tx.ContractAddress != "" {
+						t.Errorf("ContractAddress = %q, want empty", tx.ContractAddress)
+					}
+				}
+
+				if fixture.wantMaxFees {
+					if tx.MaxFeePerGas == nil || *tx.MaxFeePerGas != ethTx.GasFeeCap().String() {
+						t.Errorf("MaxFeePerGas = %v, want %s", tx.MaxFeePerGas, ethTx.GasFeeCap())
+					}
+					if tx.MaxPriorityFeePerGas == nil || *tx.MaxPriorityFeePerGas != ethTx.GasTipCap().String() {
+						t.Errorf("MaxPriorityFeePerGas = %v, want %s", tx.MaxPriorityFeePerGas, ethTx.GasTipCap())
+					}
+				} else if tx.MaxFeePerGas != nil || tx.MaxPriorityFeePerGas != nil {
+					t.Errorf("MaxFeePerGas = %v, MaxPriorityFeePerGas = %v, want nil", tx.MaxFeePerGas, tx.MaxPriorityFeePerGas)
+				}
+
+				if tx.EffectiveGasPrice != fixture.wantEffectiveGasPrice.String() {
+					t.Errorf("EffectiveGasPrice = %s, want %s", tx.EffectiveGasPrice, fixture.wantEffectiveGasPrice)
+				}
+				if tx.Fee != fixture.wantFee.String() {
+					t.Errorf("Fee = %s, want %s", tx.Fee, fixture.wantFee)
+				}
+
+				authority := crypto.PubkeyToAddress(fixtureAuthorityKey.PublicKey).Hex()
+				if len(tx.AuthorizationList) != fixture.wantAuthorizations {
+					t.Fatalf("AuthorizationList has %d entries, want %d", len(tx.AuthorizationList), fixture.wantAuthorizations)
+				}
+				for i, auth := range tx.AuthorizationList {
+					if auth.Address != fixtureDelegate.Hex() || auth.Nonce != uint64(i) {
+						t.Errorf("AuthorizationList[%d] = %s nonce %d, want %s nonce %d", i, auth.Address, auth.Nonce, fixtureDelegate.Hex(), i)
+					}
+					if auth.Authority == nil || *auth.Authority != authority {
+						t.Errorf("AuthorizationList[%d].Authority = %v, want %s", i, auth.Authority, authority)
+					}
+				}
+			})
+		}
+	}
+}
+
+// Set-code transactions come from the node in their binary or JSON encoding;
+// both must decode into a transaction whose authorization list is mapped,
+// including authorizations with an invalid signature.
+func TestSetCodeTransactionDecoding(t *testing.T) {
+	key, err := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	if err != nil {
+		t.Fatal(err)
+	}
+	chainID := params.MainnetChainConfig.ChainID
+
+	invalid := signAuthorization(t, types.SetCodeAuthorization{ChainID: *uint256.MustFromBig(chainID), Address: fixtureDelegate, Nonce: 3})
+	invalid.V = 5
+
+	signed := signFixture(t, key, types.LatestSignerForChainID(chainID), &types.SetCodeTx{
+		ChainID:   uint256.MustFromBig(chainID),
+		Nonce:     42,
+		GasTipCap: uint256.NewInt(1 * gwei),
+		GasFeeCap: uint256.NewInt(20 * gwei),
+		Gas:       80000,
+		To:        fixtureTo,
+		Value:     uint256.NewInt(0),
+		Data:      common.FromHex("0xd09de08a"),
+		AuthList: []types.SetCodeAuthorization{
+			signAuthorization(t, types.SetCodeAuthorization{ChainID: *uint256.MustFromBig(chainID), Address: fixtureDelegate, Nonce: 7}),
+			invalid,
+		},
+	})
+
+	raw, err := signed.MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to encode set-code transaction: %v", err)
+	}
+	jsonTx, err := signed.MarshalJSON()
+	if err != nil {
+		t.Fatalf("failed to encode set-code transaction as JSON: %v", err)
+	}
+
+	decoders := map[string]func(tx *types.Transaction) error{
+		"binary": func(tx *types.Transaction) error { return tx.UnmarshalBinary(raw) },
+		"json":   func(tx *types.Transaction) error { return tx.UnmarshalJSON(jsonTx) },
+	}
+	for name, decode := range decoders {
+		t.Run(name, func(t *testing.T) {
+			ethTx := new(types.Transaction)
+			err := decode(ethTx)
+			if err != nil {
+				t.Fatalf("failed to decode set-code transaction: %v", err)
+			}
+			if ethTx.Hash() != signed.Hash() {
+				t.Fatalf("decoded hash = %s, want %s", ethTx.Hash().Hex(), signed.Hash().Hex())
+			}
+
+			receipt := &types.Receipt{Status: types.ReceiptStatusSuccessful, GasUsed: 46000, BlockHash: common.HexToHash("0xb10c")}
+			tx, err := mapTransactionToModel(ethTx, receipt, fixtureHeader(), chainID)
+			if err != nil {
+				t.Fatalf("mapTransactionToModel failed: %v", err)
+			}
+
+			if tx.Type != types.SetCodeTxType {
+				t.Errorf("Type = %d, want %d", tx.Type, types.SetCodeTxType)
+			}
+			if tx.From != crypto.PubkeyToAddress(key.PublicKey).Hex() {
+				t.Errorf("From = %s, want %s", tx.From, crypto.PubkeyToAddress(key.PublicKey).Hex())
+			}
+			if len(tx.AuthorizationList) != 2 {
+				t.Fatalf("AuthorizationList has %d entries, want 2", len(tx.AuthorizationList))
+			}
+
+			valid := tx.AuthorizationList[0]
+			authority := crypto.PubkeyToAddress(fixtureAuthorityKey.PublicKey).Hex()
+			if valid.ChainID != "1" || valid.Address != fixtureDelegate.Hex() || valid.Nonce != 7 {
+				t.Errorf("AuthorizationList[0] = chain %s, %s nonce %d, want chain 1, %s nonce 7",
+					valid.ChainID, valid.Address, valid.Nonce, fixtureDelegate.Hex())
+			}
+			if valid.Authority == nil || *valid.Authority != authority {
+				t.Errorf("AuthorizationList[0].Authority = %v, want %s", valid.Authority, authority)
+			}
+			if tx.AuthorizationList[1].Authority != nil {
+				t.Errorf("AuthorizationList[1].Authority = %s, want nil for an invalid signature", *tx.AuthorizationList[1].Authority)
+			}
+		})
+	}
+}
+
+func TestParseTransactionQuery(t *testing.T) {
+	tests := []struct {
+		query   string
+		wantErr bool
+	}{
+		{query: ""},
+		{query: "fromBlock=10&toBlock=20"},
+		{query: "fromBlock=20&toBlock=20"},
+		{query: "fromBlock=21&toBlock=20", wantErr: true},
+		{query: "fromBlock=abc", wantErr: true},
+		{query: "limit=0", wantErr: true},
+		{query: "from=0x12", wantErr: true},
+		{query: "sort=-blockNumber"},
+		{query: "sort=value", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/lime/all?"+tt.query, nil)
+			_, err := parseTransactionQuery(r)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseTransactionQuery(%q) error = %v, wantErr %v", tt.query, err, tt.wantErr)
+			}
+		})
+	}
+}
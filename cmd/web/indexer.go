@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"slices"
+	"sync"
+	"time"
+
+	"eth-fetcher.ddzhalev.net/internal/web3"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	indexerCheckpoint = "indexer"
+	indexerRetryDelay = 5 * time.Second
+)
+
+// indexerState holds the progress of the block indexer reported by the status endpoint.
+type indexerState struct {
+	mu                 sync.Mutex
+	headBlock          *uint64
+	lastProcessedBlock *uint64
+	lastError          string
+}
+
+func (s *indexerState) setHead(head uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.headBlock = &head
+}
+
+func (s *indexerState) setProcessed(block uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastProcessedBlock = &block
+	s.lastError = ""
+}
+
+func (s *indexerState) setError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastError = err.Error()
+}
+
+func (s *indexerState) snapshot() (headBlock, lastProcessedBlock *uint64, lastError string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.headBlock, s.lastProcessedBlock, s.lastError
+}
+
+// StartIndexer follows the chain head when the indexer is enabled, storing every
+// transaction sent from or to one of the watched addresses. Progress is kept in
+// the checkpoints table, so after a restart the indexer first catches up on the
+// blocks it missed.
+func (app *application) StartIndexer() {
+	if !app.config.indexerEnabled {
+		return
+	}
+
+	go func() {
+		app.logger.Info("starting block indexer", "watchedAddresses", len(app.config.indexerAddresses))
+
+		for {
+			err := app.followChainHead(context.Background())
+			app.logger.Error("block indexer stopped, retrying", "error", err, "delay", indexerRetryDelay)
+			app.indexer.setError(err)
+			time.Sleep(indexerRetryDelay)
+		}
+	}()
+}
+
+func (app *application) followChainHead(ctx context.Context) error {
+	heads := make(chan *types.Header)
+	sub, err := app.contractInteractor.SubscribeNewHeads(ctx, heads)
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to new heads: %w", err)
+	}
+	defer sub.Unsubscribe()
+
+	// Catch up to the current head right away instead of waiting for the next block.
+	head, err := app.ethClient.BlockNumber(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get the latest block number: %w", err)
+	}
+
+	err = app.indexUpTo(ctx, head)
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case header := <-heads:
+			err := app.indexUpTo(ctx, header.Number.Uint64())
+			if err != nil {
+				return err
+			}
+		case err := <-sub.Err():
+			return fmt.Errorf("new head subscription failed: %w", err)
+		}
+	}
+}
+
+// indexUpTo indexes every block after the checkpoint up to head, moving the
+// checkpoint forward after each block.
+func (app *application) indexUpTo(ctx context.Context, head uint64) error {
+	app.indexer.setHead(head)
+
+	next, err := app.nextIndexerBlock(head)
+	if err != nil {
+		return err
+	}
+
+	for number := next; number <= head; number++ {
+		err := app.indexBlock(ctx, number)
+		if err != nil {
+			return err
+		}
+
+		err = app.checkpoints.Set(indexerCheckpoint, number)
+		if err != nil {
+			return fmt.Errorf("failed to save indexer checkpoint: %w", err)
+		}
+		app.indexer.setProcessed(number)
+	}
+
+	return nil
+}
+
+// nextIndexerBlock returns the block after the checkpoint. Without a checkpoint
+// the indexer starts at INDEXER_START_BLOCK, or at head when that is not set.
+func (app *application) nextIndexerBlock(head uint64) (uint64, error) {
+	checkpoint, err := app.checkpoints.Get(indexerCheckpoint)
+	if err == nil {
+		return checkpoint + 1, nil
+	}
+	if err.Error() != "checkpoint not found" {
+		return 0, fmt.Errorf("failed to load indexer checkpoint: %w", err)
+	}
+
+	if app.config.indexerStartBlock >= 0 {
+		return uint64(app.config.indexerStartBlock), nil
+	}
+	return head, nil
+}
+
+func (app *application) indexBlock(ctx context.Context, number uint64) error {
+	blockTxs, err := web3.FetchBlockTransactions(ctx, app.ethClient.Client(), new(big.Int).SetUint64(number))
+	if err != nil {
+		return fmt.Errorf("failed to fetch block %d: %w", number, err)
+	}
+
+	var hashStrings []string
+	for _, blockTx := range blockTxs {
+		watched := slices.Contains(app.config.indexerAddresses, blockTx.From)
+		if blockTx.To != nil && slices.Contains(app.config.indexerAddresses, *blockTx.To) {
+			watched = true
+		}
+		if watched {
+			hashStrings = append(hashStrings, blockTx.Hash.Hex())
+		}
+	}
+
+	if len(hashStrings) == 0 {
+		return nil
+	}
+
+	lookup, err := app.fetchTransactions(ctx, hashStrings)
+	if err != nil {
+		return fmt.Errorf("failed to index block %d: %w", number, err)
+	}
+
+	// Only not_found and invalid_hash are permanent. Any other error fails the
+	// block so that the checkpoint stays before it and the block is retried.
+	for _, txErr := range lookup.errors {
+		if txErr.Code != errCodeNotFound && txErr.Code != errCodeInvalidHash {
+			return fmt.Errorf("failed to index transaction %s in block %d: %s", txErr.Hash, number, txErr.Message)
+		}
+		app.logger.Warn("failed to index transaction", "block", number, "hash", txErr.Hash, "error", txErr.Message)
+	}
+	app.logger.Info("indexed block", "block", number, "transactions", len(lookup.transactions))
+
+	return nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"eth-fetcher.ddzhalev.net/internal/models"
+	"eth-fetcher.ddzhalev.net/internal/web3"
+)
+
+// ResumeIngestJobs restarts the ingest jobs that were still running when the
+// service stopped. They continue after the last block they finished.
+func (app *application) ResumeIngestJobs() {
+	jobs, err := app.ingestJobs.GetByStatus(models.IngestStatusRunning)
+	if err != nil {
+		app.logger.Error("failed to load running ingest jobs", "error", err)
+		return
+	}
+
+	for _, job := range jobs {
+		app.logger.Info("resuming ingest job", "id", job.ID, "nextBlock", job.NextBlock(), "toBlock", job.ToBlock)
+		app.startIngestJob(job)
+	}
+}
+
+// ingestRunner keeps track of the ingest jobs running in this process so that
+// they can be cancelled.
+type ingestRunner struct {
+	mu   sync.Mutex
+	jobs map[int]*runningIngestJob
+}
+
+type runningIngestJob struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newIngestRunner() *ingestRunner {
+	return &ingestRunner{jobs: make(map[int]*runningIngestJob)}
+}
+
+func (ir *ingestRunner) add(id int, cancel context.CancelFunc) *runningIngestJob {
+	ir.mu.Lock()
+	defer ir.mu.Unlock()
+	running := &runningIngestJob{cancel: cancel, done: make(chan struct{})}
+	ir.jobs[id] = running
+	return running
+}
+
+func (ir *ingestRunner) remove(id int) {
+	ir.mu.Lock()
+	defer ir.mu.Unlock()
+	delete(ir.jobs, id)
+}
+
+// cancel stops the job with the given id and returns a channel that is closed
+// once the job has recorded its final status. It returns false if the job is
+// not running.
+func (ir *ingestRunner) cancel(id int) (<-chan struct{}, bool) {
+	ir.mu.Lock()
+	defer ir.mu.Unlock()
+	running, ok := ir.jobs[id]
+	if !ok {
+		return nil, false
+	}
+	running.cancel()
+	return running.done, true
+}
+
+func (app *application) startIngestJob(job *models.IngestJob) {
+	ctx, cancel := context.WithCancel(context.Background())
+	running := app.ingestRunner.add(job.ID, cancel)
+
+	go func() {
+		defer close(running.done)
+		defer app.ingestRunner.remove(job.ID)
+		defer cancel()
+
+		err := app.runIngestJob(ctx, job)
+		if errors.Is(err, context.Canceled) {
+			err = app.ingestJobs.UpdateStatus(job, models.IngestStatusCancelled, nil)
+			if err != nil {
+				app.logger.Error("failed to mark ingest job as cancelled", "id", job.ID, "error", err)
+				return
+			}
+			app.logger.Info("ingest job cancelled", "id", job.ID, "lastProcessedBlock", job.LastProcessedBlock)
+			return
+		}
+		if err != nil {
+			app.logger.Error("ingest job failed", "id", job.ID, "error", err)
+
+			message := err.Error()
+			err = app.ingestJobs.UpdateStatus(job, models.IngestStatusFailed, &message)
+			if err != nil {
+				app.logger.Error("failed to mark ingest job as failed", "id", job.ID, "error", err)
+			}
+			return
+		}
+
+		err = app.ingestJobs.UpdateStatus(job, models.IngestStatusCompleted, nil)
+		if err != nil {
+			app.logger.Error("failed to mark ingest job as completed", "id", job.ID, "error", err)
+			return
+		}
+		app.logger.Info("ingest job completed", "id", job.ID, "transactions", job.TransactionsIngested, "failed", job.TransactionsFailed)
+	}()
+}
+
+// runIngestJob fetches and stores the transactions of every remaining block of
+// job, recording progress after each block. Transactions that cannot be fetched
+// are counted as failed without stopping the job. Once ctx is cancelled the job
+// stops without recording the block it was working on.
+func (app *application) runIngestJob(ctx context.Context, job *models.IngestJob) error {
+	for number := job.NextBlock(); number <= job.ToBlock; number++ {
+		summary, err := web3.FetchBlockByNumber(ctx, app.ethClient.Client(), new(big.Int).SetUint64(number))
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			return fmt.Errorf("failed to fetch block %d: %w", number, err)
+		}
+
+		lookup, err := app.fetchTransactions(ctx, blockTransactionHashes(summary))
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			return fmt.Errorf("failed to ingest block %d: %w", number, err)
+		}
+
+		for _, txErr := range lookup.errors {
+			app.logger.Warn("failed to ingest transaction", "id", job.ID, "block", number, "hash", txErr.Hash, "error", txErr.Message)
+		}
+
+		err = app.ingestJobs.UpdateProgress(job, number, len(lookup.transactions), len(lookup.errors))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestIngestRunnerCancel(t *testing.T) {
+	ir := newIngestRunner()
+
+	_, ok := ir.cancel(1)
+	if ok {
+		t.Fatal("cancel of an unknown job succeeded")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	running := ir.add(1, cancel)
+	go func() {
+		defer close(running.done)
+		defer ir.remove(1)
+		<-ctx.Done()
+	}()
+
+	done, ok := ir.cancel(1)
+	if !ok {
+		t.Fatal("cancel of a running job failed")
+	}
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("job did not stop after being cancelled")
+	}
+
+	_, ok = ir.cancel(1)
+	if ok {
+		t.Error("cancel of a stopped job succeeded")
+	}
+}
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"flag"
+	"fmt"
 	"log"
 	"log/slog"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
 
 	"eth-fetcher.ddzhalev.net/internal/models"
 	"eth-fetcher.ddzhalev.net/internal/web3"
@@ -21,6 +25,33 @@ func main() {
 	addr := flag.String("addr", os.Getenv("API_PORT"), "HTTP network address")
 	dsn := flag.String("dsn", os.Getenv("DB_CONNECTION_URL"), "PostgreSQL data source name")
 	ethNodeURL := flag.String("ethnode", os.Getenv("ETH_NODE_URL"), "Ethereum node URL")
+
+	var cfg config
+	flag.IntVar(&cfg.fetchWorkers, "fetchworkers", envInt("FETCH_WORKERS", 8), "Maximum concurrent transaction fetches per request")
+	flag.IntVar(&cfg.rpcBatchSize, "rpcbatchsize", envInt("RPC_BATCH_SIZE", 100), "Maximum calls per JSON-RPC batch request (0 disables batching)")
+	flag.IntVar(&cfg.maxHashesPerRequest, "maxhashes", envInt("MAX_HASHES_PER_REQUEST", 100), "Maximum number of transaction hashes per request")
+	flag.DurationVar(&cfg.pendingRecheckInterval, "pendingrecheck", envDuration("PENDING_RECHECK_INTERVAL", 15*time.Second), "Interval between re-checks of pending transactions")
+	flag.DurationVar(&cfg.pendingTimeout, "pendingtimeout", envDuration("PENDING_TIMEOUT", 30*time.Minute), "Time after which an unmined pending transaction is marked dropped or replaced")
+	flag.IntVar(&cfg.maxIngestBlocks, "maxingestblocks", envInt("MAX_INGEST_BLOCKS", 10000), "Maximum number of blocks per ingest job")
+	flag.BoolVar(&cfg.indexerEnabled, "indexer", envBool("INDEXER_ENABLED", false), "Index the transactions of watched addresses as new blocks arrive")
+	indexerAddresses := flag.String("indexeraddresses", os.Getenv("INDEXER_WATCHED_ADDRESSES"), "Comma-separated addresses whose transactions are indexed")
+	flag.IntVar(&cfg.indexerStartBlock, "indexerstart", envInt("INDEXER_START_BLOCK", -1), "Block the indexer starts from when it has no checkpoint (-1 starts at the head)")
+	flag.IntVar(&cfg.confirmationDepth, "confirmations", envInt("CONFIRMATION_DEPTH", 12), "Number of confirmations after which a transaction is finalized")
+	flag.DurationVar(&cfg.reorgCheckInterval, "reorgcheck", envDuration("REORG_CHECK_INTERVAL", time.Minute), "Interval between checks of unfinalized transactions against the canonical chain")
+	flag.IntVar(&cfg.deploymentBlock, "deploymentblock", envInt("PERSON_INFO_DEPLOYMENT_BLOCK", -1), "Block the PersonInfoUpdated backfill starts from when it has no checkpoint (required on the first start)")
+	flag.IntVar(&cfg.backfillChunkSize, "backfillchunk", envInt("EVENT_BACKFILL_CHUNK_SIZE", 2000), "Maximum number of blocks per eth_getLogs call when backfilling events")
+	flag.DurationVar(&cfg.listenerMinBackoff, "listenerminbackoff", envDuration("EVENT_LISTENER_MIN_BACKOFF", time.Second), "Initial delay before restarting a failed event listener")
+	flag.DurationVar(&cfg.listenerMaxBackoff, "listenermaxbackoff", envDuration("EVENT_LISTENER_MAX_BACKOFF", time.Minute), "Maximum delay before restarting a failed event listener")
+	flag.DurationVar(&cfg.eventPollInterval, "eventpoll", envDuration("EVENT_POLL_INTERVAL", 5*time.Second), "Interval between eth_getLogs polls when ETH_SOCKET_URL is not set")
+	flag.DurationVar(&cfg.outgoingCheckInterval, "outgoingcheck", envDuration("OUTGOING_CHECK_INTERVAL", 5*time.Second), "Interval between receipt checks of sent transactions")
+	flag.DurationVar(&cfg.outgoingTimeout, "outgoingtimeout", envDuration("OUTGOING_TX_TIMEOUT", 5*time.Minute), "Time after which a sent transaction that is not mined is marked timed out")
+	flag.DurationVar(&cfg.outgoingDropAfter, "outgoingdropafter", envDuration("OUTGOING_DROP_AFTER", 24*time.Hour), "Time after which a timed out sent transaction is marked dropped and no longer checked")
+	flag.Float64Var(&cfg.gasLimitMultiplier, "gasmultiplier", envFloat("GAS_LIMIT_MULTIPLIER", 1.2), "Multiplier applied to the estimated gas of sent transactions")
+	flag.Float64Var(&cfg.maxFeePerGasGwei, "maxfee", envFloat("MAX_FEE_PER_GAS_GWEI", 100), "Ceiling on the max fee per gas of sent transactions, in gwei (0 disables it)")
+	flag.Float64Var(&cfg.maxPriorityFeeGwei, "maxpriorityfee", envFloat("MAX_PRIORITY_FEE_GWEI", 2), "Ceiling on the priority fee per gas of sent transactions, in gwei (0 disables it)")
+	flag.IntVar(&cfg.feeBumpPercent, "feebump", envInt("REPLACEMENT_FEE_BUMP_PERCENT", 12), "Percentage by which a replacement raises the fees of the transaction it replaces (at least 10)")
+	flag.DurationVar(&cfg.speedupAfter, "speedupafter", envDuration("OUTGOING_SPEEDUP_AFTER", time.Minute), "Time after which a pending sent transaction is replaced with higher fees (0 disables it)")
+	flag.IntVar(&cfg.maxFeeBumps, "maxfeebumps", envInt("OUTGOING_MAX_FEE_BUMPS", 3), "Maximum number of automatic fee bumps per sent transaction")
 	flag.Parse()
 
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
@@ -28,6 +59,19 @@ func main() {
 		AddSource: true,
 	}))
 
+	err := validateConfig(cfg)
+	if err != nil {
+		logger.Error("invalid configuration", "error", err)
+		os.Exit(1)
+	}
+
+	watchedAddresses, err := parseAddressList(*indexerAddresses)
+	if err != nil {
+		logger.Error("invalid indexer watched addresses", "error", err)
+		os.Exit(1)
+	}
+	cfg.indexerAddresses = watchedAddresses
+
 	db, err := openDB(*dsn)
 	if err != nil {
 		logger.Error("failed to open database", "error", err)
@@ -35,28 +79,68 @@ func main() {
 	}
 	defer db.Close()
 
+	// Without a checkpoint the backfill would otherwise scan the chain from genesis.
+	if cfg.deploymentBlock < 0 {
+		_, err := (&models.CheckpointModel{DB: db}).Get(web3.PersonInfoEventsCheckpoint)
+		if err != nil {
+			logger.Error("PERSON_INFO_DEPLOYMENT_BLOCK must be set to the block the contract was deployed in until events have been backfilled once", "error", err)
+			os.Exit(1)
+		}
+	}
+
 	ethClient, err := ethclient.Dial(*ethNodeURL)
 	if err != nil {
 		logger.Error("failed to connect to Ethereum node", "error", err)
 		os.Exit(1)
 	}
 
-	contractInteractor, err := web3.NewPersonInfoContractInteractor()
+	chainID, err := ethClient.ChainID(context.Background())
+	if err != nil {
+		logger.Error("failed to get chain ID", "error", err)
+		os.Exit(1)
+	}
+
+	signer, err := web3.NewSignerFromEnv(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to create transaction signer: %v", err)
+	}
+
+	contractInteractor, err := web3.NewPersonInfoContractInteractor(signer, web3.PollingConfig{
+		Interval:      cfg.eventPollInterval,
+		MaxBlockRange: uint64(cfg.backfillChunkSize),
+	}, feeConfig(cfg))
 	if err != nil {
 		log.Fatalf("Failed to create contract interactor: %v", err)
 	}
 
 	app := &application{
-		logger:             logger,
-		transactions:       &models.TransactionModel{DB: db},
-		users:              &models.UserModel{DB: db},
-		personInfoEvents:   &models.PersonInfoEventModel{DB: db},
-		ethClient:          ethClient,
-		jwtSecret:          os.Getenv("JWT_SECRET"),
-		contractInteractor: contractInteractor,
+		logger:               logger,
+		transactions:         &models.TransactionModel{DB: db},
+		users:                &models.UserModel{DB: db},
+		personInfoEvents:     &models.PersonInfoEventModel{DB: db},
+		pendingTransactions:  &models.PendingTransactionModel{DB: db},
+		transactionLogs:      &models.TransactionLogModel{DB: db},
+		contractABIs:         &models.ContractABIModel{DB: db},
+		tokenTransfers:       &models.TokenTransferModel{DB: db},
+		ingestJobs:           &models.IngestJobModel{DB: db},
+		checkpoints:          &models.CheckpointModel{DB: db},
+		outgoingTransactions: &models.OutgoingTransactionModel{DB: db},
+		ethClient:            ethClient,
+		chainID:              chainID,
+		jwtSecret:            os.Getenv("JWT_SECRET"),
+		contractInteractor:   contractInteractor,
+		indexer:              &indexerState{},
+		ingestRunner:         newIngestRunner(),
+		eventListenerHealth:  web3.NewListenerHealth(),
+		config:               cfg,
 	}
 
 	app.StartEventListener()
+	app.StartPendingReconciler()
+	app.StartReorgValidator()
+	app.ResumeIngestJobs()
+	app.StartIndexer()
+	app.StartOutgoingTracker()
 
 	srv := &http.Server{
 		Addr:     *addr,
@@ -83,6 +167,13 @@ func openDB(dsn string) (*sql.DB, error) {
 	userModel := &models.UserModel{DB: db}
 	transactionModel := &models.TransactionModel{DB: db}
 	personModel := &models.PersonInfoEventModel{DB: db}
+	pendingTransactionModel := &models.PendingTransactionModel{DB: db}
+	transactionLogModel := &models.TransactionLogModel{DB: db}
+	contractABIModel := &models.ContractABIModel{DB: db}
+	tokenTransferModel := &models.TokenTransferModel{DB: db}
+	ingestJobModel := &models.IngestJobModel{DB: db}
+	checkpointModel := &models.CheckpointModel{DB: db}
+	outgoingTransactionModel := &models.OutgoingTransactionModel{DB: db}
 
 	if err := userModel.CreateTable(); err != nil {
 		return nil, err
@@ -96,6 +187,34 @@ func openDB(dsn string) (*sql.DB, error) {
 		return nil, err
 	}
 
+	if err := pendingTransactionModel.CreateTable(); err != nil {
+		return nil, err
+	}
+
+	if err := transactionLogModel.CreateTable(); err != nil {
+		return nil, err
+	}
+
+	if err := contractABIModel.CreateTable(); err != nil {
+		return nil, err
+	}
+
+	if err := tokenTransferModel.CreateTable(); err != nil {
+		return nil, err
+	}
+
+	if err := ingestJobModel.CreateTable(); err != nil {
+		return nil, err
+	}
+
+	if err := checkpointModel.CreateTable(); err != nil {
+		return nil, err
+	}
+
+	if err := outgoingTransactionModel.CreateTable(); err != nil {
+		return nil, err
+	}
+
 	if err := userModel.InitializeDefaultUsers(hashWithJwtSecret); err != nil {
 		return nil, err
 	}
@@ -110,3 +229,83 @@ func loadEnvFile() {
 		log.Fatalf("Error loading .env file")
 	}
 }
+
+// feeConfig converts the fee settings of cfg to the contract interactor's
+// FeeConfig, leaving out ceilings set to 0.
+func feeConfig(cfg config) web3.FeeConfig {
+	fees := web3.FeeConfig{
+		GasLimitMultiplier:     cfg.gasLimitMultiplier,
+		ReplacementBumpPercent: cfg.feeBumpPercent,
+	}
+	if cfg.maxFeePerGasGwei > 0 {
+		fees.MaxFeePerGas = web3.GweiToWei(cfg.maxFeePerGasGwei)
+	}
+	if cfg.maxPriorityFeeGwei > 0 {
+		fees.MaxPriorityFeePerGas = web3.GweiToWei(cfg.maxPriorityFeeGwei)
+	}
+	return fees
+}
+
+// validateConfig rejects settings the background workers cannot run with, such
+// as ticker intervals that are not positive.
+func validateConfig(cfg config) error {
+	intervals := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"PENDING_RECHECK_INTERVAL", cfg.pendingRecheckInterval},
+		{"REORG_CHECK_INTERVAL", cfg.reorgCheckInterval},
+		{"EVENT_POLL_INTERVAL", cfg.eventPollInterval},
+		{"OUTGOING_CHECK_INTERVAL", cfg.outgoingCheckInterval},
+	}
+	for _, interval := range intervals {
+		if interval.value <= 0 {
+			return fmt.Errorf("%s must be a positive duration, got %s", interval.name, interval.value)
+		}
+	}
+
+	if cfg.listenerMinBackoff <= 0 {
+		return fmt.Errorf("EVENT_LISTENER_MIN_BACKOFF must be a positive duration, got %s", cfg.listenerMinBackoff)
+	}
+	if cfg.listenerMaxBackoff < cfg.listenerMinBackoff {
+		return fmt.Errorf("EVENT_LISTENER_MAX_BACKOFF must not be less than EVENT_LISTENER_MIN_BACKOFF, got %s and %s",
+			cfg.listenerMaxBackoff, cfg.listenerMinBackoff)
+	}
+
+	if cfg.maxIngestBlocks <= 0 {
+		return fmt.Errorf("MAX_INGEST_BLOCKS must be positive, got %d", cfg.maxIngestBlocks)
+	}
+	return nil
+}
+
+func envInt(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+func envFloat(key string, fallback float64) float64 {
+	value, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+func envBool(key string, fallback bool) bool {
+	value, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidateConfig(t *testing.T) {
+	valid := config{
+		pendingRecheckInterval: 15 * time.Second,
+		reorgCheckInterval:     time.Minute,
+		eventPollInterval:      5 * time.Second,
+		outgoingCheckInterval:  5 * time.Second,
+		maxIngestBlocks:        10000,
+		listenerMinBackoff:     time.Second,
+		listenerMaxBackoff:     time.Minute,
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(cfg *config)
+		wantErr bool
+	}{
+		{name: "defaults", modify: func(cfg *config) {}},
+		{name: "zero pending recheck", modify: func(cfg *config) { cfg.pendingRecheckInterval = 0 }, wantErr: true},
+		{name: "negative reorg check", modify: func(cfg *config) { cfg.reorgCheckInterval = -time.Second }, wantErr: true},
+		{name: "zero event poll", modify: func(cfg *config) { cfg.eventPollInterval = 0 }, wantErr: true},
+		{name: "zero outgoing check", modify: func(cfg *config) { cfg.outgoingCheckInterval = 0 }, wantErr: true},
+		{name: "zero min backoff", modify: func(cfg *config) { cfg.listenerMinBackoff = 0 }, wantErr: true},
+		{name: "negative min backoff", modify: func(cfg *config) { cfg.listenerMinBackoff = -time.Second }, wantErr: true},
+		{name: "max backoff below min", modify: func(cfg *config) { cfg.listenerMaxBackoff = 500 * time.Millisecond }, wantErr: true},
+		{name: "equal backoffs", modify: func(cfg *config) { cfg.listenerMaxBackoff = cfg.listenerMinBackoff }},
+		{name: "zero max ingest blocks", modify: func(cfg *config) { cfg.maxIngestBlocks = 0 }, wantErr: true},
+		{name: "negative max ingest blocks", modify: func(cfg *config) { cfg.maxIngestBlocks = -1 }, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := valid
+			tt.modify(&cfg)
+			err := validateConfig(cfg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
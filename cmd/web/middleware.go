@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"runtime/debug"
@@ -43,6 +44,19 @@ func (app *application) clientError(w http.ResponseWriter, status int) {
 	http.Error(w, http.StatusText(status), status)
 }
 
+// invalidHashesError responds with 400 and, for a *hashValidationError, the
+// list of rejected inputs.
+func (app *application) invalidHashesError(w http.ResponseWriter, r *http.Request, err error) {
+	response := map[string]interface{}{"error": err.Error()}
+
+	var validationErr *hashValidationError
+	if errors.As(err, &validationErr) {
+		response["errors"] = validationErr.rejected
+	}
+
+	app.responseJSONWithStatus(w, r, http.StatusBadRequest, response)
+}
+
 func (app *application) validateToken(w http.ResponseWriter, r *http.Request) (string, error) {
 	tokenString := r.Header.Get("AUTH_TOKEN")
 	if tokenString == "" {
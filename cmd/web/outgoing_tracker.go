@@ -0,0 +1,327 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"eth-fetcher.ddzhalev.net/internal/models"
+	"eth-fetcher.ddzhalev.net/internal/web3"
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// StartOutgoingTracker periodically checks the receipts of the transactions sent
+// by the service. Submitted transactions become mined or failed once included,
+// or timed_out if they are not included within OUTGOING_TX_TIMEOUT. Timed out
+// transactions keep being checked, as they may still be mined later, until they
+// are dropped because their nonce was used by another transaction or they are
+// older than OUTGOING_DROP_AFTER. A
+// submitted transaction still pending after OUTGOING_SPEEDUP_AFTER is replaced
+// with higher fees, at most OUTGOING_MAX_FEE_BUMPS times per nonce.
+func (app *application) StartOutgoingTracker() {
+	go func() {
+		app.logger.Info("starting outgoing transaction tracker", "interval", app.config.outgoingCheckInterval)
+
+		ticker := time.NewTicker(app.config.outgoingCheckInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			app.trackOutgoingTransactions(context.Background())
+		}
+	}()
+}
+
+func (app *application) trackOutgoingTransactions(ctx context.Context) {
+	outgoingTxs, err := app.outgoingTransactions.GetByStatus(models.OutgoingStatusSubmitted, models.OutgoingStatusTimedOut)
+	if err != nil {
+		app.logger.Error("failed to load outgoing transactions", "error", err)
+		return
+	}
+
+	for _, outgoingTx := range outgoingTxs {
+		err := app.trackOutgoingTransaction(ctx, outgoingTx)
+		if err != nil {
+			app.logger.Error("failed to track outgoing transaction", "hash", outgoingTx.TransactionHash, "error", err)
+		}
+	}
+}
+
+func (app *application) trackOutgoingTransaction(ctx context.Context, outgoingTx *models.OutgoingTransaction) error {
+	hash := outgoingTx.TransactionHash
+
+	included, err := app.checkOutgoingReceipt(ctx, outgoingTx)
+	if err != nil || included {
+		return err
+	}
+
+	// Any of the transactions this one replaced may still be mined instead.
+	if outgoingTx.Replaces != nil {
+		replaced, err := app.outgoingTransactions.GetByNonce(outgoingTx.From, outgoingTx.Nonce)
+		if err != nil {
+			return fmt.Errorf("failed to load replaced transactions: %w", err)
+		}
+
+		for _, replacedTx := range replaced {
+			if replacedTx.Status != models.OutgoingStatusReplaced {
+				continue
+			}
+
+			included, err := app.checkOutgoingReceipt(ctx, replacedTx)
+			if err != nil {
+				return err
+			}
+			if included {
+				return app.outgoingTransactions.MarkReplaced(hash, replacedTx.TransactionHash)
+			}
+		}
+	}
+
+	if outgoingTx.Status == models.OutgoingStatusTimedOut {
+		return app.dropTimedOutTransaction(ctx, outgoingTx)
+	}
+	if outgoingTx.Status != models.OutgoingStatusSubmitted {
+		return nil
+	}
+
+	if time.Since(outgoingTx.SubmittedAt) > app.config.outgoingTimeout {
+		app.logger.Warn("outgoing transaction timed out", "hash", hash, "submittedAt", outgoingTx.SubmittedAt)
+
+		// A transaction dropped from the mempool leaves a nonce gap that holds back
+		// every later transaction until the nonce is used again.
+		err := app.contractInteractor.ResyncNonces(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to resync nonces: %w", err)
+		}
+
+		return app.outgoingTransactions.UpdateStatus(hash, models.OutgoingStatusTimedOut)
+	}
+
+	if app.speedupDue(outgoingTx) {
+		replacement, err := app.replaceOutgoingTransaction(ctx, outgoingTx, false, outgoingTx.SubmittedBy)
+		if errors.Is(err, errReplacementClaimed) {
+			return nil
+		}
+		if err != nil {
+			// The failure is recorded so that the next attempt waits another
+			// OUTGOING_SPEEDUP_AFTER instead of being repeated on every tick.
+			recordErr := app.outgoingTransactions.RecordSpeedupFailure(hash, err.Error())
+			if recordErr != nil {
+				app.logger.Error("failed to record speed-up failure", "hash", hash, "error", recordErr)
+			}
+			return fmt.Errorf("failed to speed up transaction: %w", err)
+		}
+		app.logger.Info("outgoing transaction sped up", "hash", hash, "replacement", replacement.TransactionHash, "feeBumps", replacement.FeeBumps)
+	}
+
+	return nil
+}
+
+// speedupDue reports whether a submitted transaction should be sped up: it has
+// been pending for OUTGOING_SPEEDUP_AFTER, has fee bumps left and its last
+// failed speed-up, if any, was at least OUTGOING_SPEEDUP_AFTER ago.
+func (app *application) speedupDue(outgoingTx *models.OutgoingTransaction) bool {
+	if app.config.speedupAfter <= 0 || outgoingTx.FeeBumps >= app.config.maxFeeBumps {
+		return false
+	}
+	if time.Since(outgoingTx.SubmittedAt) <= app.config.speedupAfter {
+		return false
+	}
+	return outgoingTx.SpeedupFailedAt == nil || time.Since(*outgoingTx.SpeedupFailedAt) > app.config.speedupAfter
+}
+
+// dropTimedOutTransaction stops tracking a timed out transaction once it can no
+// longer be mined, because another transaction of the sender was mined with its
+// nonce, or once it was submitted more than OUTGOING_DROP_AFTER ago.
+func (app *application) dropTimedOutTransaction(ctx context.Context, outgoingTx *models.OutgoingTransaction) error {
+	hash := outgoingTx.TransactionHash
+
+	nonce, err := app.ethClient.NonceAt(ctx, common.HexToAddress(outgoingTx.From), nil)
+	if err != nil {
+		return fmt.Errorf("failed to get the sender nonce: %w", err)
+	}
+
+	nonceUsed := nonce > outgoingTx.Nonce
+	if nonceUsed {
+		// It may have been mined since its receipt was checked.
+		included, err := app.checkOutgoingReceipt(ctx, outgoingTx)
+		if err != nil || included {
+			return err
+		}
+	} else if time.Since(outgoingTx.SubmittedAt) < app.config.outgoingDropAfter {
+		return nil
+	}
+
+	app.logger.Warn("outgoing transaction dropped", "hash", hash, "nonce", outgoingTx.Nonce, "nonceUsed", nonceUsed)
+	return app.outgoingTransactions.UpdateStatus(hash, models.OutgoingStatusDropped)
+}
+
+// checkOutgoingReceipt records the receipt of outgoingTx if it was included and
+// reports whether it was.
+func (app *application) checkOutgoingReceipt(ctx context.Context, outgoingTx *models.OutgoingTransaction) (bool, error) {
+	hash := outgoingTx.TransactionHash
+
+	receipt, err := app.ethClient.TransactionReceipt(ctx, common.HexToHash(hash))
+	if err != nil {
+		if errors.Is(err, ethereum.NotFound) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to fetch receipt: %w", err)
+	}
+
+	status := models.OutgoingStatusMined
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		status = models.OutgoingStatusFailed
+	}
+
+	app.logger.Info("outgoing transaction included", "hash", hash, "status", status, "blockNumber", receipt.BlockNumber)
+	err = app.outgoingTransactions.MarkIncluded(hash, status, receipt.BlockNumber.Uint64(), receipt.BlockHash.Hex(), receipt.GasUsed)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// errInputNotStored is returned when speeding up a transaction stored before its
+// input was recorded.
+var errInputNotStored = errors.New("the transaction input is not stored, it can only be cancelled")
+
+// errReplacementClaimed is returned when another replacement of the transaction
+// was started first, or it was mined in the meantime.
+var errReplacementClaimed = errors.New("the transaction is already being replaced or is no longer pending")
+
+// replaceOutgoingTransaction sends a transaction with the nonce of outgoingTx and
+// higher fees, repeating its call or, if cancel is set, transferring nothing to
+// the sender. outgoingTx is claimed first, so that concurrent manual and
+// automatic replacements cannot both send one. The replacement is stored before
+// it is sent and outgoingTx is marked replaced by it; if sending fails the
+// replacement is removed and outgoingTx gets its status back.
+func (app *application) replaceOutgoingTransaction(ctx context.Context, outgoingTx *models.OutgoingTransaction, cancel bool, submittedBy string) (*models.OutgoingTransaction, error) {
+	previous, err := outgoingTransactionFees(outgoingTx)
+	if err != nil {
+		return nil, err
+	}
+
+	method, arguments := outgoingTx.Method, outgoingTx.Arguments
+	if cancel {
+		method, arguments = "cancel", json.RawMessage("{}")
+	} else if outgoingTx.Input == "" && outgoingTx.Method != "cancel" {
+		return nil, errInputNotStored
+	}
+
+	claimed, err := app.outgoingTransactions.ClaimForReplacement(outgoingTx.TransactionHash, outgoingTx.Status)
+	if err != nil {
+		return nil, err
+	}
+	if !claimed {
+		return nil, errReplacementClaimed
+	}
+
+	var replacement *models.OutgoingTransaction
+	record := func(ethTx *types.Transaction) error {
+		replacement = app.newOutgoingTransaction(ethTx, method, arguments, submittedBy)
+		replacement.Replaces = &outgoingTx.TransactionHash
+		replacement.FeeBumps = outgoingTx.FeeBumps + 1
+		return app.outgoingTransactions.Insert(replacement)
+	}
+
+	if cancel {
+		_, err = app.contractInteractor.CancelTransaction(ctx, outgoingTx.Nonce, previous, record)
+	} else {
+		_, err = app.contractInteractor.ReplaceTransaction(ctx, outgoingTx.Nonce, common.HexToAddress(outgoingTx.To),
+			common.FromHex(outgoingTx.Input), outgoingTx.GasLimit, previous, record)
+	}
+	if err != nil {
+		if replacement != nil && replacement.ID != 0 {
+			deleteErr := app.outgoingTransactions.Delete(replacement.TransactionHash)
+			if deleteErr != nil {
+				app.logger.Error("failed to delete unsent replacement", "hash", replacement.TransactionHash, "error", deleteErr)
+			}
+		}
+
+		releaseErr := app.outgoingTransactions.ReleaseReplacementClaim(outgoingTx.TransactionHash, outgoingTx.Status)
+		if releaseErr != nil {
+			app.logger.Error("failed to release replacement claim", "hash", outgoingTx.TransactionHash, "error", releaseErr)
+		}
+		return nil, err
+	}
+
+	err = app.outgoingTransactions.MarkReplaced(outgoingTx.TransactionHash, replacement.TransactionHash)
+	if err != nil {
+		return nil, err
+	}
+	return replacement, nil
+}
+
+// newOutgoingTransaction returns the record of ethTx, a submitted call of method
+// with the given arguments.
+func (app *application) newOutgoingTransaction(ethTx *types.Transaction, method string, arguments json.RawMessage, submittedBy string) *models.OutgoingTransaction {
+	maxFeePerGas, maxPriorityFeePerGas := dynamicFeeCaps(ethTx)
+
+	return &models.OutgoingTransaction{
+		TransactionHash: ethTx.Hash().Hex(),
+		Status:          models.OutgoingStatusSubmitted,
+		Method:          method,
+		Arguments:       arguments,
+		From:            app.contractInteractor.Address().Hex(),
+		To:              ethTx.To().Hex(),
+		Nonce:           ethTx.Nonce(),
+		GasLimit:        ethTx.Gas(),
+		GasPrice:        ethTx.GasPrice().String(),
+		SubmittedBy:     submittedBy,
+
+		MaxFeePerGas:         maxFeePerGas,
+		MaxPriorityFeePerGas: maxPriorityFeePerGas,
+		Input:                common.Bytes2Hex(ethTx.Data()),
+	}
+}
+
+// outgoingTransactionFees returns the fees outgoingTx was sent with.
+func outgoingTransactionFees(outgoingTx *models.OutgoingTransaction) (*web3.TransactionFees, error) {
+	parse := func(value string) (*big.Int, error) {
+		number, ok := new(big.Int).SetString(value, 10)
+		if !ok {
+			return nil, fmt.Errorf("invalid fee %q", value)
+		}
+		return number, nil
+	}
+
+	fees := &web3.TransactionFees{GasLimit: outgoingTx.GasLimit}
+	if outgoingTx.MaxFeePerGas == nil || outgoingTx.MaxPriorityFeePerGas == nil {
+		gasPrice, err := parse(outgoingTx.GasPrice)
+		if err != nil {
+			return nil, err
+		}
+		fees.GasPrice = gasPrice
+		return fees, nil
+	}
+
+	var err error
+	fees.GasFeeCap, err = parse(*outgoingTx.MaxFeePerGas)
+	if err != nil {
+		return nil, err
+	}
+	fees.GasTipCap, err = parse(*outgoingTx.MaxPriorityFeePerGas)
+	if err != nil {
+		return nil, err
+	}
+	return fees, nil
+}
+
+// outgoingTransactionResponse is the response to a request that sent outgoingTx.
+func outgoingTransactionResponse(outgoingTx *models.OutgoingTransaction) map[string]interface{} {
+	return map[string]interface{}{
+		"txHash":               outgoingTx.TransactionHash,
+		"txStatus":             outgoingTx.Status,
+		"nonce":                outgoingTx.Nonce,
+		"gasLimit":             outgoingTx.GasLimit,
+		"gasPrice":             outgoingTx.GasPrice,
+		"maxFeePerGas":         outgoingTx.MaxFeePerGas,
+		"maxPriorityFeePerGas": outgoingTx.MaxPriorityFeePerGas,
+		"replaces":             outgoingTx.Replaces,
+	}
+}
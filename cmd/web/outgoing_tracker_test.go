@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"eth-fetcher.ddzhalev.net/internal/models"
+)
+
+func TestSpeedupDue(t *testing.T) {
+	app := &application{config: config{speedupAfter: time.Minute, maxFeeBumps: 3}}
+	ago := func(d time.Duration) *time.Time {
+		at := time.Now().Add(-d)
+		return &at
+	}
+
+	tests := []struct {
+		name string
+		tx   models.OutgoingTransaction
+		want bool
+	}{
+		{name: "recently submitted", tx: models.OutgoingTransaction{SubmittedAt: *ago(30 * time.Second)}, want: false},
+		{name: "pending too long", tx: models.OutgoingTransaction{SubmittedAt: *ago(2 * time.Minute)}, want: true},
+		{name: "no fee bumps left", tx: models.OutgoingTransaction{SubmittedAt: *ago(2 * time.Minute), FeeBumps: 3}, want: false},
+		{
+			name: "recent speed-up failure",
+			tx:   models.OutgoingTransaction{SubmittedAt: *ago(5 * time.Minute), SpeedupFailedAt: ago(10 * time.Second)},
+			want: false,
+		},
+		{
+			name: "old speed-up failure",
+			tx:   models.OutgoingTransaction{SubmittedAt: *ago(5 * time.Minute), SpeedupFailedAt: ago(2 * time.Minute)},
+			want: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := app.speedupDue(&tt.tx); got != tt.want {
+				t.Errorf("speedupDue() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	disabled := &application{config: config{speedupAfter: 0, maxFeeBumps: 3}}
+	if disabled.speedupDue(&models.OutgoingTransaction{SubmittedAt: *ago(time.Hour)}) {
+		t.Error("speedupDue() = true with OUTGOING_SPEEDUP_AFTER set to 0")
+	}
+}
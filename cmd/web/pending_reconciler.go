@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"eth-fetcher.ddzhalev.net/internal/models"
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// StartPendingReconciler periodically re-checks transactions in the pending store,
+// promoting mined ones into the transactions table and marking the ones that
+// disappeared from the mempool as dropped or replaced.
+func (app *application) StartPendingReconciler() {
+	go func() {
+		app.logger.Info("starting pending transaction reconciler", "interval", app.config.pendingRecheckInterval)
+
+		ticker := time.NewTicker(app.config.pendingRecheckInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			app.reconcilePendingTransactions(context.Background())
+		}
+	}()
+}
+
+func (app *application) reconcilePendingTransactions(ctx context.Context) {
+	pendingTxs, err := app.pendingTransactions.GetByStatus(models.PendingStatusPending)
+	if err != nil {
+		app.logger.Error("failed to load pending transactions", "error", err)
+		return
+	}
+
+	headers := newHeaderCache(app.ethClient)
+	for _, pendingTx := range pendingTxs {
+		err := app.reconcilePendingTransaction(ctx, pendingTx, headers)
+		if err != nil {
+			app.logger.Error("failed to reconcile pending transaction", "hash", pendingTx.TransactionHash, "error", err)
+		}
+	}
+}
+
+func (app *application) reconcilePendingTransaction(ctx context.Context, pendingTx *models.PendingTransaction, headers *headerCache) error {
+	hash := pendingTx.TransactionHash
+
+	data, err := app.fetchTransactionData(ctx, hash, headers)
+	if err != nil && !errors.Is(err, ethereum.NotFound) {
+		return err
+	}
+
+	if err == nil && !data.Pending {
+		result, err := app.storeTransaction(hash, data)
+		if err != nil {
+			return err
+		}
+		if result.err != nil {
+			return errors.New(result.err.Message)
+		}
+
+		app.logger.Info("pending transaction mined", "hash", hash, "blockNumber", result.tx.BlockNumber)
+		return nil
+	}
+
+	// A transaction the node still has in its mempool stays pending however long
+	// it waits; only one the node no longer knows can time out.
+	if err == nil || time.Since(pendingTx.FirstSeenAt) < app.config.pendingTimeout {
+		return app.pendingTransactions.Touch(hash)
+	}
+
+	// Once the sender's mined nonce moved past ours another transaction with the
+	// same nonce was included, otherwise the node simply dropped it.
+	status := models.PendingStatusDropped
+	nonce, err := app.ethClient.NonceAt(ctx, common.HexToAddress(pendingTx.From), nil)
+	if err != nil {
+		return err
+	}
+	if nonce > pendingTx.Nonce {
+		status = models.PendingStatusReplaced
+	}
+
+	app.logger.Info("pending transaction timed out", "hash", hash, "status", status)
+	return app.pendingTransactions.UpdateStatus(hash, status)
+}
@@ -9,12 +9,26 @@ func (app *application) routes() http.Handler {
 
 	mux.HandleFunc("GET /lime/eth", app.getEth)
 	mux.HandleFunc("GET /lime/eth/{rlphex}", app.getEthRlp)
+	mux.HandleFunc("GET /lime/eth/{hash}/logs", app.getTransactionLogs)
 	mux.HandleFunc("GET /lime/all", app.getAll)
+	mux.HandleFunc("GET /lime/address/{address}", app.getAddress)
+	mux.HandleFunc("POST /lime/abi/{address}", app.postContractABI)
+	mux.HandleFunc("GET /lime/block/{numberOrHash}", app.getBlock)
+	mux.HandleFunc("POST /lime/ingest", app.postIngest)
+	mux.HandleFunc("GET /lime/ingest/{id}", app.getIngestJob)
+	mux.HandleFunc("POST /lime/ingest/{id}/cancel", app.postCancelIngestJob)
+	mux.HandleFunc("GET /lime/indexer/status", app.getIndexerStatus)
+	mux.HandleFunc("GET /lime/health", app.getHealth)
 
 	mux.HandleFunc("POST /lime/authenticate", app.postAuth)
 	mux.HandleFunc("GET /lime/my", app.getMy)
 	mux.HandleFunc("POST /lime/savePerson", app.postSavePerson)
+	mux.HandleFunc("GET /lime/savePerson/{txHash}", app.getSavePersonStatus)
+	mux.HandleFunc("POST /lime/savePerson/{txHash}/speedup", app.postSpeedUpSavePerson)
+	mux.HandleFunc("POST /lime/savePerson/{txHash}/cancel", app.postCancelSavePerson)
 	mux.HandleFunc("GET /lime/listPersons", app.getPersonList)
+	mux.HandleFunc("GET /lime/persons/{index}", app.getPerson)
+	mux.HandleFunc("GET /lime/persons/{index}/history", app.getPersonHistory)
 
 	return app.recoverPanic(app.logRequest(mux))
 }
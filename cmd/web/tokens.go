@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"eth-fetcher.ddzhalev.net/internal/models"
+	"eth-fetcher.ddzhalev.net/internal/web3"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// loadTokenTransfers fills in token metadata and formatted amounts of the
+// stored transfers, keyed by transaction hash. Transfers are derived from logs
+// for transactions stored before transfers were indexed; transactions missing
+// from logs keep their stored transfers.
+func (app *application) loadTokenTransfers(ctx context.Context, transfers map[string][]*models.TokenTransfer, logs map[string][]*models.TransactionLog) (map[string][]*models.TokenTransfer, error) {
+	for hash, txLogs := range logs {
+		derived := mapTokenTransfersToModel(txLogs)
+		if len(derived) != len(transfers[hash]) {
+			err := app.tokenTransfers.InsertMany(derived)
+			if err != nil {
+				return nil, fmt.Errorf("failed to insert token transfers of transaction %s: %w", hash, err)
+			}
+			transfers[hash] = derived
+		}
+	}
+
+	var tokenAddresses []string
+	for _, hashTransfers := range transfers {
+		for _, transfer := range hashTransfers {
+			tokenAddresses = append(tokenAddresses, transfer.TokenAddress)
+		}
+	}
+
+	if len(tokenAddresses) == 0 {
+		return transfers, nil
+	}
+
+	metadata, err := app.loadTokenMetadata(ctx, tokenAddresses)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, hashTransfers := range transfers {
+		for _, transfer := range hashTransfers {
+			transfer.Token = metadata[transfer.TokenAddress]
+			if transfer.Token != nil && transfer.Token.Decimals != nil && transfer.Amount != nil {
+				transfer.FormattedAmount = formatTokenAmount(*transfer.Amount, *transfer.Token.Decimals)
+			}
+		}
+	}
+
+	return transfers, nil
+}
+
+// loadTokenMetadata returns the metadata of the given tokens keyed by address,
+// reading tokens not cached yet from the node. If the node cannot be reached the
+// metadata of those tokens is left out and fetched again on the next request.
+func (app *application) loadTokenMetadata(ctx context.Context, addresses []string) (map[string]*models.TokenMetadata, error) {
+	metadata, err := app.tokenTransfers.GetMetadata(addresses)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get token metadata from the DB: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	var missing []common.Address
+	for _, address := range addresses {
+		if metadata[address] == nil && !seen[address] {
+			seen[address] = true
+			missing = append(missing, common.HexToAddress(address))
+		}
+	}
+
+	if len(missing) == 0 {
+		return metadata, nil
+	}
+
+	fetched, err := web3.FetchTokenMetadata(ctx, app.ethClient.Client(), missing, app.config.rpcBatchSize)
+	if err != nil {
+		app.logger.Warn("failed to fetch token metadata", "error", err)
+		return metadata, nil
+	}
+
+	for _, token := range fetched {
+		err := app.tokenTransfers.UpsertMetadata(token)
+		if err != nil {
+			return nil, fmt.Errorf("failed to store metadata of token %s: %w", token.Address, err)
+		}
+		metadata[token.Address] = token
+	}
+
+	return metadata, nil
+}
+
+// formatTokenAmount renders an integer token amount as a decimal number, e.g.
+// 1500000 with 6 decimals as "1.5".
+func formatTokenAmount(amount string, decimals int) string {
+	value, ok := new(big.Int).SetString(amount, 10)
+	if !ok || decimals <= 0 {
+		return amount
+	}
+
+	unit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+	whole, fraction := new(big.Int).QuoRem(value, unit, new(big.Int))
+	if fraction.Sign() == 0 {
+		return whole.String()
+	}
+
+	fractionDigits := fmt.Sprintf("%0*s", decimals, fraction.String())
+	return whole.String() + "." + strings.TrimRight(fractionDigits, "0")
+}
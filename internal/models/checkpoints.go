@@ -0,0 +1,46 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// CheckpointModel stores the last block processed by background workers, keyed by
+// worker name, so they can resume where they stopped.
+type CheckpointModel struct {
+	DB *sql.DB
+}
+
+func (m *CheckpointModel) CreateTable() error {
+	_, err := m.DB.Exec(`
+		CREATE TABLE IF NOT EXISTS checkpoints (
+			name VARCHAR(64) PRIMARY KEY,
+			blockNumber BIGINT NOT NULL,
+			updatedAt TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)
+	`)
+	return err
+}
+
+func (m *CheckpointModel) Get(name string) (uint64, error) {
+	var blockNumber uint64
+	err := m.DB.QueryRow(`SELECT blockNumber FROM checkpoints WHERE name = $1`, name).Scan(&blockNumber)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, errors.New("checkpoint not found")
+		}
+		return 0, err
+	}
+	return blockNumber, nil
+}
+
+func (m *CheckpointModel) Set(name string, blockNumber uint64) error {
+	query := `
+		INSERT INTO checkpoints (name, blockNumber)
+		VALUES ($1, $2)
+		ON CONFLICT (name) DO UPDATE
+		SET blockNumber = EXCLUDED.blockNumber, updatedAt = NOW()
+	`
+	_, err := m.DB.Exec(query, name, blockNumber)
+	return err
+}
@@ -0,0 +1,95 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type ContractABI struct {
+	Address    string    `json:"address"`
+	ABI        string    `json:"abi"`
+	UploadedBy string    `json:"uploadedBy"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// DecodedCall is transaction calldata decoded with a contract ABI.
+type DecodedCall struct {
+	Method    string                 `json:"method"`
+	Signature string                 `json:"signature"`
+	Arguments map[string]interface{} `json:"arguments"`
+}
+
+// DecodedEvent is an event log decoded with a contract ABI.
+type DecodedEvent struct {
+	Event     string                 `json:"event"`
+	Signature string                 `json:"signature"`
+	Fields    map[string]interface{} `json:"fields"`
+}
+
+type ContractABIModel struct {
+	DB *sql.DB
+}
+
+func (m *ContractABIModel) CreateTable() error {
+	_, err := m.DB.Exec(`
+		CREATE TABLE IF NOT EXISTS contract_abis (
+			address VARCHAR(42) PRIMARY KEY,
+			abi TEXT NOT NULL,
+			uploadedBy VARCHAR(50) NOT NULL,
+			updatedAt TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)
+	`)
+	return err
+}
+
+// Upsert stores the ABI of a contract. An ABI that is already stored can only
+// be replaced by the user who uploaded it.
+func (m *ContractABIModel) Upsert(contractABI *ContractABI) error {
+	query := `
+		INSERT INTO contract_abis (address, abi, uploadedBy)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (address) DO UPDATE
+		SET abi = EXCLUDED.abi, updatedAt = NOW()
+		WHERE contract_abis.uploadedBy = EXCLUDED.uploadedBy
+		RETURNING updatedAt
+	`
+	err := m.DB.QueryRow(query, contractABI.Address, contractABI.ABI, contractABI.UploadedBy).Scan(&contractABI.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return errors.New("contract ABI uploaded by another user")
+		}
+		return err
+	}
+	return nil
+}
+
+// GetMultiple returns the stored ABIs keyed by contract address.
+func (m *ContractABIModel) GetMultiple(addresses []string) (map[string]*ContractABI, error) {
+	query := `
+		SELECT address, abi, uploadedBy, updatedAt
+		FROM contract_abis
+		WHERE address = ANY($1)
+	`
+	rows, err := m.DB.Query(query, pq.Array(addresses))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	contractABIs := make(map[string]*ContractABI)
+	for rows.Next() {
+		contractABI := &ContractABI{}
+		err := rows.Scan(&contractABI.Address, &contractABI.ABI, &contractABI.UploadedBy, &contractABI.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		contractABIs[contractABI.Address] = contractABI
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return contractABIs, nil
+}
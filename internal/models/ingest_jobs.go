@@ -0,0 +1,148 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const (
+	IngestStatusRunning   = "running"
+	IngestStatusCompleted = "completed"
+	IngestStatusFailed    = "failed"
+	IngestStatusCancelled = "cancelled"
+)
+
+type IngestJob struct {
+	ID                   int       `json:"id"`
+	FromBlock            uint64    `json:"fromBlock"`
+	ToBlock              uint64    `json:"toBlock"`
+	LastProcessedBlock   *uint64   `json:"lastProcessedBlock"`
+	Status               string    `json:"status"`
+	TransactionsIngested int       `json:"transactionsIngested"`
+	TransactionsFailed   int       `json:"transactionsFailed"`
+	Error                *string   `json:"error"`
+	CreatedBy            string    `json:"createdBy"`
+	CreatedAt            time.Time `json:"createdAt"`
+	UpdatedAt            time.Time `json:"updatedAt"`
+	Progress             float64   `json:"progress"`
+}
+
+// NextBlock returns the first block the job still has to process.
+func (job *IngestJob) NextBlock() uint64 {
+	if job.LastProcessedBlock == nil {
+		return job.FromBlock
+	}
+	return *job.LastProcessedBlock + 1
+}
+
+func (job *IngestJob) updateProgress() {
+	total := job.ToBlock - job.FromBlock + 1
+	job.Progress = float64(job.NextBlock()-job.FromBlock) / float64(total)
+}
+
+type IngestJobModel struct {
+	DB *sql.DB
+}
+
+const ingestJobColumns = `id, fromBlock, toBlock, lastProcessedBlock, status, transactionsIngested, transactionsFailed, error, createdBy, createdAt, updatedAt`
+
+func (m *IngestJobModel) CreateTable() error {
+	_, err := m.DB.Exec(`
+		CREATE TABLE IF NOT EXISTS ingest_jobs (
+			id SERIAL PRIMARY KEY,
+			fromBlock BIGINT NOT NULL,
+			toBlock BIGINT NOT NULL,
+			lastProcessedBlock BIGINT,
+			status VARCHAR(16) NOT NULL,
+			transactionsIngested INTEGER NOT NULL DEFAULT 0,
+			transactionsFailed INTEGER NOT NULL DEFAULT 0,
+			error TEXT,
+			createdBy VARCHAR(50) NOT NULL,
+			createdAt TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			updatedAt TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)
+	`)
+	return err
+}
+
+func (m *IngestJobModel) Insert(job *IngestJob) error {
+	query := `
+		INSERT INTO ingest_jobs (fromBlock, toBlock, status, createdBy)
+		VALUES ($1, $2, $3, $4)
+		RETURNING ` + ingestJobColumns
+	return m.scanIngestJob(m.DB.QueryRow(query, job.FromBlock, job.ToBlock, job.Status, job.CreatedBy), job)
+}
+
+func (m *IngestJobModel) Get(id int) (*IngestJob, error) {
+	query := `
+		SELECT ` + ingestJobColumns + `
+		FROM ingest_jobs
+		WHERE id = $1
+	`
+	job := &IngestJob{}
+	err := m.scanIngestJob(m.DB.QueryRow(query, id), job)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.New("ingest job not found")
+		}
+		return nil, err
+	}
+	return job, nil
+}
+
+func (m *IngestJobModel) GetByStatus(status string) ([]*IngestJob, error) {
+	query := `
+		SELECT ` + ingestJobColumns + `
+		FROM ingest_jobs
+		WHERE status = $1
+		ORDER BY id
+	`
+	rows, err := m.DB.Query(query, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []*IngestJob{}
+	for rows.Next() {
+		job := &IngestJob{}
+		err := m.scanIngestJob(rows, job)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// UpdateProgress records that every block up to lastProcessedBlock has been ingested.
+func (m *IngestJobModel) UpdateProgress(job *IngestJob, lastProcessedBlock uint64, ingested, failed int) error {
+	query := `
+		UPDATE ingest_jobs
+		SET lastProcessedBlock = $1, transactionsIngested = transactionsIngested + $2, transactionsFailed = transactionsFailed + $3, updatedAt = NOW()
+		WHERE id = $4
+		RETURNING ` + ingestJobColumns
+	return m.scanIngestJob(m.DB.QueryRow(query, lastProcessedBlock, ingested, failed, job.ID), job)
+}
+
+func (m *IngestJobModel) UpdateStatus(job *IngestJob, status string, errMessage *string) error {
+	query := `
+		UPDATE ingest_jobs
+		SET status = $1, error = $2, updatedAt = NOW()
+		WHERE id = $3
+		RETURNING ` + ingestJobColumns
+	return m.scanIngestJob(m.DB.QueryRow(query, status, errMessage, job.ID), job)
+}
+
+func (m *IngestJobModel) scanIngestJob(row rowScanner, job *IngestJob) error {
+	err := row.Scan(&job.ID, &job.FromBlock, &job.ToBlock, &job.LastProcessedBlock, &job.Status, &job.TransactionsIngested, &job.TransactionsFailed, &job.Error, &job.CreatedBy, &job.CreatedAt, &job.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	job.updateProgress()
+	return nil
+}
@@ -0,0 +1,285 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	OutgoingStatusSubmitted = "submitted"
+	OutgoingStatusMined     = "mined"
+	OutgoingStatusFailed    = "failed"
+	OutgoingStatusTimedOut  = "timed_out"
+	OutgoingStatusReplaced  = "replaced"
+	OutgoingStatusDropped   = "dropped"
+)
+
+// OutgoingTransaction is a transaction sent by the service, tracked until its
+// receipt shows whether it succeeded. A transaction sent again with the same
+// nonce to speed it up or cancel it is stored as a new row that Replaces the
+// previous one, which becomes replaced.
+type OutgoingTransaction struct {
+	ID              int             `json:"id"`
+	TransactionHash string          `json:"transactionHash"`
+	Status          string          `json:"status"`
+	Method          string          `json:"method"`
+	Arguments       json.RawMessage `json:"arguments"`
+	From            string          `json:"from"`
+	To              string          `json:"to"`
+	Nonce           uint64          `json:"nonce"`
+	GasLimit        uint64          `json:"gasLimit"`
+	GasPrice        string          `json:"gasPrice"`
+	BlockNumber     *uint64         `json:"blockNumber"`
+	BlockHash       *string         `json:"blockHash"`
+	GasUsed         *uint64         `json:"gasUsed"`
+	SubmittedBy     string          `json:"submittedBy"`
+	SubmittedAt     time.Time       `json:"submittedAt"`
+	UpdatedAt       time.Time       `json:"updatedAt"`
+
+	// MaxFeePerGas and MaxPriorityFeePerGas are only set for dynamic fee
+	// transactions, whose GasPrice holds the fee cap.
+	MaxFeePerGas         *string `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas *string `json:"maxPriorityFeePerGas"`
+
+	Input      string  `json:"input"`
+	Replaces   *string `json:"replaces"`
+	ReplacedBy *string `json:"replacedBy"`
+	// FeeBumps counts the replacements sent for the nonce up to this transaction.
+	FeeBumps int `json:"feeBumps"`
+	// SpeedupError and SpeedupFailedAt describe the last automatic speed-up that
+	// failed, after which the next one is delayed.
+	SpeedupError    *string    `json:"speedupError"`
+	SpeedupFailedAt *time.Time `json:"speedupFailedAt"`
+}
+
+type OutgoingTransactionModel struct {
+	DB *sql.DB
+}
+
+const outgoingTransactionColumns = `
+	id, transactionHash, status, method, arguments, fromAddress, toAddress, nonce, gasLimit, gasPrice,
+	blockNumber, blockHash, gasUsed, submittedBy, submittedAt, updatedAt, maxFeePerGas, maxPriorityFeePerGas,
+	COALESCE(input, ''), replaces, replacedBy, feeBumps, speedupError, speedupFailedAt
+`
+
+func (m *OutgoingTransactionModel) CreateTable() error {
+	_, err := m.DB.Exec(`
+		CREATE TABLE IF NOT EXISTS outgoing_transactions (
+			id SERIAL PRIMARY KEY,
+			transactionHash VARCHAR(66) UNIQUE NOT NULL,
+			status VARCHAR(16) NOT NULL,
+			method TEXT NOT NULL,
+			arguments JSONB NOT NULL,
+			fromAddress VARCHAR(42) NOT NULL,
+			toAddress VARCHAR(42) NOT NULL,
+			nonce BIGINT NOT NULL,
+			gasLimit BIGINT NOT NULL,
+			gasPrice TEXT NOT NULL,
+			blockNumber BIGINT,
+			blockHash VARCHAR(66),
+			gasUsed BIGINT,
+			submittedBy VARCHAR(50) NOT NULL,
+			submittedAt TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			updatedAt TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = m.DB.Exec(`
+		ALTER TABLE outgoing_transactions
+			ADD COLUMN IF NOT EXISTS maxFeePerGas TEXT,
+			ADD COLUMN IF NOT EXISTS maxPriorityFeePerGas TEXT,
+			ADD COLUMN IF NOT EXISTS input TEXT,
+			ADD COLUMN IF NOT EXISTS replaces VARCHAR(66),
+			ADD COLUMN IF NOT EXISTS replacedBy VARCHAR(66),
+			ADD COLUMN IF NOT EXISTS feeBumps INTEGER NOT NULL DEFAULT 0,
+			ADD COLUMN IF NOT EXISTS speedupError TEXT,
+			ADD COLUMN IF NOT EXISTS speedupFailedAt TIMESTAMPTZ
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = m.DB.Exec(`
+		CREATE INDEX IF NOT EXISTS outgoing_transactions_status_idx ON outgoing_transactions (status);
+		CREATE INDEX IF NOT EXISTS outgoing_transactions_nonce_idx ON outgoing_transactions (fromAddress, nonce);
+	`)
+	return err
+}
+
+func (m *OutgoingTransactionModel) Insert(tx *OutgoingTransaction) error {
+	query := `
+		INSERT INTO outgoing_transactions (
+			transactionHash, status, method, arguments, fromAddress, toAddress, nonce, gasLimit, gasPrice, maxFeePerGas, maxPriorityFeePerGas,
+			submittedBy, input, replaces, feeBumps
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+		RETURNING id, submittedAt, updatedAt
+	`
+	return m.DB.QueryRow(query, tx.TransactionHash, tx.Status, tx.Method, []byte(tx.Arguments), tx.From, tx.To, tx.Nonce, tx.GasLimit, tx.GasPrice,
+		tx.MaxFeePerGas, tx.MaxPriorityFeePerGas, tx.SubmittedBy, tx.Input, tx.Replaces, tx.FeeBumps).
+		Scan(&tx.ID, &tx.SubmittedAt, &tx.UpdatedAt)
+}
+
+func (m *OutgoingTransactionModel) Get(hash string) (*OutgoingTransaction, error) {
+	query := `
+		SELECT ` + outgoingTransactionColumns + `
+		FROM outgoing_transactions
+		WHERE transactionHash = $1
+	`
+	tx, err := scanOutgoingTransaction(m.DB.QueryRow(query, hash))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.New("outgoing transaction not found")
+		}
+		return nil, err
+	}
+	return tx, nil
+}
+
+func (m *OutgoingTransactionModel) GetByStatus(statuses ...string) ([]*OutgoingTransaction, error) {
+	query := `
+		SELECT ` + outgoingTransactionColumns + `
+		FROM outgoing_transactions
+		WHERE status = ANY($1)
+		ORDER BY id
+	`
+	return m.getMultipleOutgoingTransactions(query, pq.Array(statuses))
+}
+
+// GetByNonce returns the transactions sent from the address from with the given
+// nonce, that is a transaction and its replacements, oldest first.
+func (m *OutgoingTransactionModel) GetByNonce(from string, nonce uint64) ([]*OutgoingTransaction, error) {
+	query := `
+		SELECT ` + outgoingTransactionColumns + `
+		FROM outgoing_transactions
+		WHERE fromAddress = $1 AND nonce = $2
+		ORDER BY id
+	`
+	return m.getMultipleOutgoingTransactions(query, from, nonce)
+}
+
+func (m *OutgoingTransactionModel) getMultipleOutgoingTransactions(query string, args ...interface{}) ([]*OutgoingTransaction, error) {
+	rows, err := m.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transactions := []*OutgoingTransaction{}
+	for rows.Next() {
+		tx, err := scanOutgoingTransaction(rows)
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, tx)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return transactions, nil
+}
+
+// MarkIncluded records the receipt of a transaction, with status mined or failed.
+// A replaced transaction that was mined after all is no longer marked replaced.
+func (m *OutgoingTransactionModel) MarkIncluded(hash, status string, blockNumber uint64, blockHash string, gasUsed uint64) error {
+	query := `
+		UPDATE outgoing_transactions
+		SET status = $1, blockNumber = $2, blockHash = $3, gasUsed = $4, replacedBy = NULL, updatedAt = NOW()
+		WHERE transactionHash = $5
+	`
+	_, err := m.DB.Exec(query, status, blockNumber, blockHash, gasUsed, hash)
+	return err
+}
+
+func (m *OutgoingTransactionModel) UpdateStatus(hash, status string) error {
+	query := `
+		UPDATE outgoing_transactions
+		SET status = $1, updatedAt = NOW()
+		WHERE transactionHash = $2
+	`
+	_, err := m.DB.Exec(query, status, hash)
+	return err
+}
+
+// Delete removes the record of a transaction that could not be sent.
+func (m *OutgoingTransactionModel) Delete(hash string) error {
+	_, err := m.DB.Exec(`DELETE FROM outgoing_transactions WHERE transactionHash = $1`, hash)
+	return err
+}
+
+// MarkReplaced marks the transaction hash as replaced by the transaction replacedBy.
+func (m *OutgoingTransactionModel) MarkReplaced(hash, replacedBy string) error {
+	query := `
+		UPDATE outgoing_transactions
+		SET status = $1, replacedBy = $2, updatedAt = NOW()
+		WHERE transactionHash = $3
+	`
+	_, err := m.DB.Exec(query, OutgoingStatusReplaced, replacedBy, hash)
+	return err
+}
+
+// ClaimForReplacement marks the transaction hash as replaced before its
+// replacement is sent, provided it still has status. It reports whether the
+// claim succeeded; only one replacement can claim a transaction.
+func (m *OutgoingTransactionModel) ClaimForReplacement(hash, status string) (bool, error) {
+	query := `
+		UPDATE outgoing_transactions
+		SET status = $1, replacedBy = NULL, updatedAt = NOW()
+		WHERE transactionHash = $2 AND status = $3
+	`
+	result, err := m.DB.Exec(query, OutgoingStatusReplaced, hash, status)
+	if err != nil {
+		return false, err
+	}
+
+	claimed, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return claimed > 0, nil
+}
+
+// ReleaseReplacementClaim gives the transaction hash its status back after its
+// replacement could not be sent. A transaction that was mined in the meantime
+// keeps its new status.
+func (m *OutgoingTransactionModel) ReleaseReplacementClaim(hash, status string) error {
+	query := `
+		UPDATE outgoing_transactions
+		SET status = $1, updatedAt = NOW()
+		WHERE transactionHash = $2 AND status = $3 AND replacedBy IS NULL
+	`
+	_, err := m.DB.Exec(query, status, hash, OutgoingStatusReplaced)
+	return err
+}
+
+// RecordSpeedupFailure records why the last automatic speed-up of the
+// transaction hash failed.
+func (m *OutgoingTransactionModel) RecordSpeedupFailure(hash, message string) error {
+	query := `
+		UPDATE outgoing_transactions
+		SET speedupError = $1, speedupFailedAt = NOW(), updatedAt = NOW()
+		WHERE transactionHash = $2
+	`
+	_, err := m.DB.Exec(query, message, hash)
+	return err
+}
+
+func scanOutgoingTransaction(row rowScanner) (*OutgoingTransaction, error) {
+	tx := &OutgoingTransaction{}
+	var arguments []byte
+	err := row.Scan(&tx.ID, &tx.TransactionHash, &tx.Status, &tx.Method, &arguments, &tx.From, &tx.To, &tx.Nonce, &tx.GasLimit, &tx.GasPrice,
+		&tx.BlockNumber, &tx.BlockHash, &tx.GasUsed, &tx.SubmittedBy, &tx.SubmittedAt, &tx.UpdatedAt, &tx.MaxFeePerGas, &tx.MaxPriorityFeePerGas,
+		&tx.Input, &tx.Replaces, &tx.ReplacedBy, &tx.FeeBumps, &tx.SpeedupError, &tx.SpeedupFailedAt)
+	if err != nil {
+		return nil, err
+	}
+	tx.Arguments = arguments
+	return tx, nil
+}
@@ -0,0 +1,142 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const (
+	PendingStatusPending  = "pending"
+	PendingStatusDropped  = "dropped"
+	PendingStatusReplaced = "replaced"
+)
+
+type PendingTransaction struct {
+	ID                   int       `json:"id"`
+	TransactionHash      string    `json:"transactionHash"`
+	Status               string    `json:"status"`
+	From                 string    `json:"from"`
+	To                   *string   `json:"to"`
+	Nonce                uint64    `json:"nonce"`
+	Gas                  uint64    `json:"gas"`
+	GasPrice             string    `json:"gasPrice"`
+	MaxFeePerGas         string    `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas string    `json:"maxPriorityFeePerGas"`
+	Input                string    `json:"input"`
+	Value                string    `json:"value"`
+	FirstSeenAt          time.Time `json:"firstSeenAt"`
+	LastCheckedAt        time.Time `json:"lastCheckedAt"`
+}
+
+type PendingTransactionModel struct {
+	DB *sql.DB
+}
+
+func (m *PendingTransactionModel) CreateTable() error {
+	_, err := m.DB.Exec(`
+		CREATE TABLE IF NOT EXISTS pending_transactions (
+			id SERIAL PRIMARY KEY,
+			transactionHash VARCHAR(66) UNIQUE NOT NULL,
+			status VARCHAR(16) NOT NULL,
+			fromAddress VARCHAR(42) NOT NULL,
+			toAddress VARCHAR(42),
+			nonce BIGINT NOT NULL,
+			gas BIGINT NOT NULL,
+			gasPrice TEXT NOT NULL,
+			maxFeePerGas TEXT NOT NULL,
+			maxPriorityFeePerGas TEXT NOT NULL,
+			input TEXT NOT NULL,
+			value TEXT NOT NULL,
+			firstSeenAt TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			lastCheckedAt TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)
+	`)
+	return err
+}
+
+// Upsert stores a transaction seen in the mempool. Seeing it again refreshes
+// lastCheckedAt and revives a transaction previously marked dropped, restarting
+// its timeout from now.
+func (m *PendingTransactionModel) Upsert(tx *PendingTransaction) error {
+	query := `
+		INSERT INTO pending_transactions (transactionHash, status, fromAddress, toAddress, nonce, gas, gasPrice, maxFeePerGas, maxPriorityFeePerGas, input, value)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (transactionHash) DO UPDATE
+		SET status = EXCLUDED.status, lastCheckedAt = NOW(),
+			firstSeenAt = CASE WHEN pending_transactions.status = EXCLUDED.status THEN pending_transactions.firstSeenAt ELSE NOW() END
+		RETURNING id, firstSeenAt, lastCheckedAt
+	`
+	return m.DB.QueryRow(query, tx.TransactionHash, tx.Status, tx.From, tx.To, tx.Nonce, tx.Gas, tx.GasPrice, tx.MaxFeePerGas, tx.MaxPriorityFeePerGas, tx.Input, tx.Value).
+		Scan(&tx.ID, &tx.FirstSeenAt, &tx.LastCheckedAt)
+}
+
+func (m *PendingTransactionModel) Get(hash string) (*PendingTransaction, error) {
+	query := `
+		SELECT id, transactionHash, status, fromAddress, toAddress, nonce, gas, gasPrice, maxFeePerGas, maxPriorityFeePerGas, input, value, firstSeenAt, lastCheckedAt
+		FROM pending_transactions
+		WHERE transactionHash = $1
+	`
+	tx := &PendingTransaction{}
+	err := m.DB.QueryRow(query, hash).Scan(&tx.ID, &tx.TransactionHash, &tx.Status, &tx.From, &tx.To, &tx.Nonce, &tx.Gas, &tx.GasPrice, &tx.MaxFeePerGas, &tx.MaxPriorityFeePerGas, &tx.Input, &tx.Value, &tx.FirstSeenAt, &tx.LastCheckedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.New("pending transaction not found")
+		}
+		return nil, err
+	}
+	return tx, nil
+}
+
+func (m *PendingTransactionModel) GetByStatus(status string) ([]*PendingTransaction, error) {
+	query := `
+		SELECT id, transactionHash, status, fromAddress, toAddress, nonce, gas, gasPrice, maxFeePerGas, maxPriorityFeePerGas, input, value, firstSeenAt, lastCheckedAt
+		FROM pending_transactions
+		WHERE status = $1
+		ORDER BY id
+	`
+	rows, err := m.DB.Query(query, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transactions := []*PendingTransaction{}
+	for rows.Next() {
+		tx := &PendingTransaction{}
+		err := rows.Scan(&tx.ID, &tx.TransactionHash, &tx.Status, &tx.From, &tx.To, &tx.Nonce, &tx.Gas, &tx.GasPrice, &tx.MaxFeePerGas, &tx.MaxPriorityFeePerGas, &tx.Input, &tx.Value, &tx.FirstSeenAt, &tx.LastCheckedAt)
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, tx)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return transactions, nil
+}
+
+func (m *PendingTransactionModel) UpdateStatus(hash, status string) error {
+	query := `
+		UPDATE pending_transactions
+		SET status = $1, lastCheckedAt = NOW()
+		WHERE transactionHash = $2
+	`
+	_, err := m.DB.Exec(query, status, hash)
+	return err
+}
+
+func (m *PendingTransactionModel) Touch(hash string) error {
+	query := `
+		UPDATE pending_transactions
+		SET lastCheckedAt = NOW()
+		WHERE transactionHash = $1
+	`
+	_, err := m.DB.Exec(query, hash)
+	return err
+}
+
+func (m *PendingTransactionModel) Delete(hash string) error {
+	_, err := m.DB.Exec(`DELETE FROM pending_transactions WHERE transactionHash = $1`, hash)
+	return err
+}
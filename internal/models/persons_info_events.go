@@ -2,63 +2,370 @@ package models
 
 import (
 	"database/sql"
+	"errors"
+	"time"
 )
 
+// PersonInfoEvent is one PersonInfoUpdated event. Every update of a person is
+// kept, so a person index can appear in several events.
 type PersonInfoEvent struct {
 	ID              int    `json:"id"`
 	PersonIndex     int    `json:"personIndex"`
 	PersonName      string `json:"personName"`
 	PersonAge       int    `json:"personAge"`
 	TransactionHash string `json:"TransactionHash"`
+	BlockNumber     uint64 `json:"blockNumber"`
+	BlockHash       string `json:"blockHash"`
+	LogIndex        uint   `json:"logIndex"`
+	BlockTimestamp  uint64 `json:"blockTimestamp"`
+	Finalized       bool   `json:"finalized"`
+}
+
+// Person is the current state of a person, taken from its latest event.
+type Person struct {
+	PersonIndex     int       `json:"personIndex"`
+	PersonName      string    `json:"personName"`
+	PersonAge       int       `json:"personAge"`
+	TransactionHash string    `json:"TransactionHash"`
+	BlockNumber     uint64    `json:"blockNumber"`
+	BlockHash       string    `json:"blockHash"`
+	LogIndex        uint      `json:"logIndex"`
+	BlockTimestamp  uint64    `json:"blockTimestamp"`
+	UpdatedAt       time.Time `json:"updatedAt"`
 }
 
 type PersonInfoEventModel struct {
 	DB *sql.DB
 }
 
+// personInfoEventColumns lists the columns read by getMultiplePersonInfoEvents.
+// Rows stored before the block columns were added have them empty.
+const personInfoEventColumns = `
+	id, personIndex, personName, personAge, transactionHash,
+	COALESCE(blockNumber, 0), COALESCE(blockHash, ''), COALESCE(logIndex, 0), COALESCE(blockTimestamp, 0), finalized
+`
+
+// latestPersonInfoEvents selects the latest event of every person, from which
+// the persons table is materialized.
+const latestPersonInfoEvents = `
+	SELECT DISTINCT ON (personIndex)
+		personIndex, personName, personAge, transactionHash,
+		COALESCE(blockNumber, 0), COALESCE(blockHash, ''), COALESCE(logIndex, 0), COALESCE(blockTimestamp, 0)
+	FROM personInfoEvents
+`
+
+const latestPersonInfoEventsOrder = `
+	ORDER BY personIndex, COALESCE(blockNumber, 0) DESC, COALESCE(logIndex, 0) DESC, id DESC
+`
+
 func (m *PersonInfoEventModel) CreateTable() error {
 	_, err := m.DB.Exec(`
 		CREATE TABLE IF NOT EXISTS personInfoEvents (
 			id SERIAL PRIMARY KEY,
-			personIndex INTEGER UNIQUE NOT NULL,
+			personIndex INTEGER NOT NULL,
 			personName TEXT NOT NULL,
 			personAge INTEGER NOT NULL,
 			transactionHash TEXT NOT NULL
 		)
 	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = m.DB.Exec(`
+		ALTER TABLE personInfoEvents
+			DROP CONSTRAINT IF EXISTS personinfoevents_personindex_key,
+			ADD COLUMN IF NOT EXISTS blockNumber BIGINT,
+			ADD COLUMN IF NOT EXISTS blockHash VARCHAR(66),
+			ADD COLUMN IF NOT EXISTS logIndex INTEGER,
+			ADD COLUMN IF NOT EXISTS blockTimestamp BIGINT,
+			ADD COLUMN IF NOT EXISTS finalized BOOLEAN NOT NULL DEFAULT FALSE
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = m.DB.Exec(`
+		CREATE UNIQUE INDEX IF NOT EXISTS person_info_events_log_idx ON personInfoEvents (transactionHash, logIndex);
+		CREATE INDEX IF NOT EXISTS person_info_events_person_idx ON personInfoEvents (personIndex, blockNumber, logIndex);
+		CREATE INDEX IF NOT EXISTS person_info_events_unfinalized_idx ON personInfoEvents (blockNumber, id) WHERE NOT finalized;
+	`)
+	if err != nil {
+		return err
+	}
 
+	_, err = m.DB.Exec(`
+		CREATE TABLE IF NOT EXISTS persons (
+			personIndex INTEGER PRIMARY KEY,
+			personName TEXT NOT NULL,
+			personAge INTEGER NOT NULL,
+			transactionHash TEXT NOT NULL,
+			blockNumber BIGINT NOT NULL,
+			blockHash VARCHAR(66) NOT NULL,
+			logIndex INTEGER NOT NULL,
+			blockTimestamp BIGINT NOT NULL,
+			updatedAt TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Materialize the persons stored before the persons table existed.
+	_, err = m.DB.Exec(`
+		INSERT INTO persons (personIndex, personName, personAge, transactionHash, blockNumber, blockHash, logIndex, blockTimestamp)
+		` + latestPersonInfoEvents + latestPersonInfoEventsOrder + `
+		ON CONFLICT (personIndex) DO NOTHING
+	`)
 	return err
 }
 
+// Insert stores an event and updates the current state of its person in one
+// transaction. An event already stored for the same log, for example one
+// re-emitted after a reorg, is overwritten and becomes unfinalized again. Events
+// stored before their log was recorded are completed instead of inserted a
+// second time.
 func (m *PersonInfoEventModel) Insert(event *PersonInfoEvent) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE personInfoEvents
+		SET blockNumber = $1, blockHash = $2, logIndex = $3, blockTimestamp = $4
+		WHERE transactionHash = $5 AND personIndex = $6 AND logIndex IS NULL
+	`
+	result, err := tx.Exec(query, event.BlockNumber, event.BlockHash, event.LogIndex, event.BlockTimestamp, event.TransactionHash, event.PersonIndex)
+	if err != nil {
+		return err
+	}
+
+	completed, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if completed == 0 {
+		query = `
+			INSERT INTO personInfoEvents (personIndex, personName, personAge, transactionHash, blockNumber, blockHash, logIndex, blockTimestamp)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			ON CONFLICT (transactionHash, logIndex) DO UPDATE
+			SET personIndex = EXCLUDED.personIndex, personName = EXCLUDED.personName, personAge = EXCLUDED.personAge,
+				blockNumber = EXCLUDED.blockNumber, blockHash = EXCLUDED.blockHash, blockTimestamp = EXCLUDED.blockTimestamp,
+				finalized = FALSE
+		`
+		_, err = tx.Exec(query, event.PersonIndex, event.PersonName, event.PersonAge, event.TransactionHash, event.BlockNumber, event.BlockHash, event.LogIndex, event.BlockTimestamp)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = refreshPersons(tx, []int{event.PersonIndex})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteByLog removes the event emitted by the given log in the block blockHash
+// and recomputes the current state of its person.
+func (m *PersonInfoEventModel) DeleteByLog(transactionHash string, logIndex uint, blockHash string) error {
 	query := `
-		INSERT INTO personInfoEvents (PersonIndex, PersonName, PersonAge, TransactionHash)
-		VALUES ($1, $2, $3, $4)
+		DELETE FROM personInfoEvents
+		WHERE transactionHash = $1 AND logIndex = $2 AND blockHash = $3
+		RETURNING personIndex
 	`
-	_, err := m.DB.Exec(query, event.PersonIndex, event.PersonName, event.PersonAge, event.TransactionHash)
+	return m.deleteAndRefresh(query, transactionHash, logIndex, blockHash)
+}
+
+// DeleteByBlockHash removes the unfinalized events emitted in the block blockHash
+// and recomputes the current state of their persons.
+func (m *PersonInfoEventModel) DeleteByBlockHash(blockHash string) error {
+	query := `
+		DELETE FROM personInfoEvents
+		WHERE blockHash = $1 AND NOT finalized
+		RETURNING personIndex
+	`
+	return m.deleteAndRefresh(query, blockHash)
+}
+
+// deleteAndRefresh runs the delete query, which returns the person index of
+// every deleted event, and recomputes those persons in the same transaction.
+func (m *PersonInfoEventModel) deleteAndRefresh(query string, args ...interface{}) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var personIndexes []int
+	for rows.Next() {
+		var personIndex int
+		err := rows.Scan(&personIndex)
+		if err != nil {
+			return err
+		}
+		personIndexes = append(personIndexes, personIndex)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	err = refreshPersons(tx, personIndexes)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// refreshPersons upserts the persons rows of personIndexes from their latest
+// remaining event and removes persons that have no events left.
+func refreshPersons(tx *sql.Tx, personIndexes []int) error {
+	for _, personIndex := range personIndexes {
+		_, err := tx.Exec(`
+			INSERT INTO persons (personIndex, personName, personAge, transactionHash, blockNumber, blockHash, logIndex, blockTimestamp)
+			`+latestPersonInfoEvents+`
+			WHERE personIndex = $1
+			`+latestPersonInfoEventsOrder+`
+			ON CONFLICT (personIndex) DO UPDATE
+			SET personName = EXCLUDED.personName, personAge = EXCLUDED.personAge, transactionHash = EXCLUDED.transactionHash,
+				blockNumber = EXCLUDED.blockNumber, blockHash = EXCLUDED.blockHash, logIndex = EXCLUDED.logIndex,
+				blockTimestamp = EXCLUDED.blockTimestamp, updatedAt = NOW()
+		`, personIndex)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`
+			DELETE FROM persons
+			WHERE personIndex = $1 AND NOT EXISTS (SELECT 1 FROM personInfoEvents WHERE personIndex = $1)
+		`, personIndex)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetUnfinalized returns up to limit events with a known block that are not
+// finalized yet, ordered by block number and id, starting after the position
+// (afterBlock, afterID), like TransactionModel.GetUnfinalized.
+func (m *PersonInfoEventModel) GetUnfinalized(afterBlock uint64, afterID, limit int) ([]*PersonInfoEvent, error) {
+	query := `
+		SELECT ` + personInfoEventColumns + `
+		FROM personInfoEvents
+		WHERE NOT finalized AND blockHash IS NOT NULL AND (blockNumber, id) > ($1, $2)
+		ORDER BY blockNumber, id
+		LIMIT $3
+	`
+	return m.getMultiplePersonInfoEvents(query, afterBlock, afterID, limit)
+}
+
+// FinalizeBefore marks the events emitted before block as finalized.
+func (m *PersonInfoEventModel) FinalizeBefore(block uint64) error {
+	_, err := m.DB.Exec(`UPDATE personInfoEvents SET finalized = TRUE WHERE NOT finalized AND blockHash IS NOT NULL AND blockNumber < $1`, block)
+	return err
+}
+
+// MarkFinalized finalizes the events emitted in the block blockHash.
+func (m *PersonInfoEventModel) MarkFinalized(blockHash string) error {
+	_, err := m.DB.Exec(`UPDATE personInfoEvents SET finalized = TRUE WHERE blockHash = $1`, blockHash)
 	return err
 }
 
-func (m *PersonInfoEventModel) GetAll() ([]*PersonInfoEvent, error) {
+// GetHistory returns every event of a person, oldest first.
+func (m *PersonInfoEventModel) GetHistory(personIndex int) ([]*PersonInfoEvent, error) {
 	query := `
-		SELECT *
+		SELECT ` + personInfoEventColumns + `
 		FROM personInfoEvents
+		WHERE personIndex = $1
+		ORDER BY COALESCE(blockNumber, 0), COALESCE(logIndex, 0), id
 	`
-	rows, err := m.DB.Query(query)
+	return m.getMultiplePersonInfoEvents(query, personIndex)
+}
+
+func (m *PersonInfoEventModel) getMultiplePersonInfoEvents(query string, args ...interface{}) ([]*PersonInfoEvent, error) {
+	rows, err := m.DB.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var events []*PersonInfoEvent
+	events := []*PersonInfoEvent{}
 	for rows.Next() {
 		event := &PersonInfoEvent{}
-		err := rows.Scan(&event.ID, &event.PersonIndex, &event.PersonName, &event.PersonAge, &event.TransactionHash)
+		err := rows.Scan(&event.ID, &event.PersonIndex, &event.PersonName, &event.PersonAge, &event.TransactionHash,
+			&event.BlockNumber, &event.BlockHash, &event.LogIndex, &event.BlockTimestamp, &event.Finalized)
 		if err != nil {
 			return nil, err
 		}
 		events = append(events, event)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
 	return events, nil
 }
+
+const personColumns = `personIndex, personName, personAge, transactionHash, blockNumber, blockHash, logIndex, blockTimestamp, updatedAt`
+
+func (m *PersonInfoEventModel) GetPerson(personIndex int) (*Person, error) {
+	query := `
+		SELECT ` + personColumns + `
+		FROM persons
+		WHERE personIndex = $1
+	`
+	person := &Person{}
+	err := scanPerson(m.DB.QueryRow(query, personIndex), person)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.New("person not found")
+		}
+		return nil, err
+	}
+	return person, nil
+}
+
+// GetPersons returns the current state of every person, ordered by index.
+func (m *PersonInfoEventModel) GetPersons() ([]*Person, error) {
+	query := `
+		SELECT ` + personColumns + `
+		FROM persons
+		ORDER BY personIndex
+	`
+	rows, err := m.DB.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	persons := []*Person{}
+	for rows.Next() {
+		person := &Person{}
+		err := scanPerson(rows, person)
+		if err != nil {
+			return nil, err
+		}
+		persons = append(persons, person)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return persons, nil
+}
+
+func scanPerson(row rowScanner, person *Person) error {
+	return row.Scan(&person.PersonIndex, &person.PersonName, &person.PersonAge, &person.TransactionHash,
+		&person.BlockNumber, &person.BlockHash, &person.LogIndex, &person.BlockTimestamp, &person.UpdatedAt)
+}
@@ -0,0 +1,165 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	TokenStandardERC20  = "ERC20"
+	TokenStandardERC721 = "ERC721"
+)
+
+type TokenTransfer struct {
+	ID              int     `json:"id"`
+	TransactionHash string  `json:"transactionHash"`
+	LogIndex        uint    `json:"logIndex"`
+	TokenAddress    string  `json:"tokenAddress"`
+	Standard        string  `json:"standard"`
+	From            string  `json:"from"`
+	To              string  `json:"to"`
+	Amount          *string `json:"amount"`
+	TokenID         *string `json:"tokenId"`
+
+	// Token and FormattedAmount are filled in from the token metadata when responding.
+	Token           *TokenMetadata `json:"token,omitempty"`
+	FormattedAmount string         `json:"formattedAmount,omitempty"`
+}
+
+type TokenMetadata struct {
+	Address   string    `json:"address"`
+	Name      *string   `json:"name"`
+	Symbol    *string   `json:"symbol"`
+	Decimals  *int      `json:"decimals"`
+	FetchedAt time.Time `json:"-"`
+}
+
+type TokenTransferModel struct {
+	DB *sql.DB
+}
+
+func (m *TokenTransferModel) CreateTable() error {
+	_, err := m.DB.Exec(`
+		CREATE TABLE IF NOT EXISTS token_transfers (
+			id SERIAL PRIMARY KEY,
+			transactionHash VARCHAR(66) NOT NULL,
+			logIndex INTEGER NOT NULL,
+			tokenAddress VARCHAR(42) NOT NULL,
+			standard VARCHAR(10) NOT NULL,
+			fromAddress VARCHAR(42) NOT NULL,
+			toAddress VARCHAR(42) NOT NULL,
+			amount TEXT,
+			tokenId TEXT,
+			UNIQUE (transactionHash, logIndex)
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = m.DB.Exec(`
+		CREATE TABLE IF NOT EXISTS token_metadata (
+			address VARCHAR(42) PRIMARY KEY,
+			name TEXT,
+			symbol TEXT,
+			decimals INTEGER,
+			fetchedAt TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)
+	`)
+	return err
+}
+
+func (m *TokenTransferModel) InsertMany(transfers []*TokenTransfer) error {
+	query := `
+		INSERT INTO token_transfers (transactionHash, logIndex, tokenAddress, standard, fromAddress, toAddress, amount, tokenId)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (transactionHash, logIndex) DO UPDATE
+		SET tokenAddress = EXCLUDED.tokenAddress, standard = EXCLUDED.standard, fromAddress = EXCLUDED.fromAddress,
+			toAddress = EXCLUDED.toAddress, amount = EXCLUDED.amount, tokenId = EXCLUDED.tokenId
+		RETURNING id
+	`
+	for _, transfer := range transfers {
+		err := m.DB.QueryRow(query, transfer.TransactionHash, transfer.LogIndex, transfer.TokenAddress, transfer.Standard, transfer.From, transfer.To, transfer.Amount, transfer.TokenID).
+			Scan(&transfer.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *TokenTransferModel) DeleteByTransactionHash(hash string) error {
+	_, err := m.DB.Exec(`DELETE FROM token_transfers WHERE transactionHash = $1`, hash)
+	return err
+}
+
+// GetByTransactionHashes returns the stored transfers grouped by transaction hash,
+// ordered by log index.
+func (m *TokenTransferModel) GetByTransactionHashes(hashes []string) (map[string][]*TokenTransfer, error) {
+	query := `
+		SELECT id, transactionHash, logIndex, tokenAddress, standard, fromAddress, toAddress, amount, tokenId
+		FROM token_transfers
+		WHERE transactionHash = ANY($1)
+		ORDER BY transactionHash, logIndex
+	`
+	rows, err := m.DB.Query(query, pq.Array(hashes))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transfers := make(map[string][]*TokenTransfer)
+	for rows.Next() {
+		transfer := &TokenTransfer{}
+		err := rows.Scan(&transfer.ID, &transfer.TransactionHash, &transfer.LogIndex, &transfer.TokenAddress, &transfer.Standard, &transfer.From, &transfer.To, &transfer.Amount, &transfer.TokenID)
+		if err != nil {
+			return nil, err
+		}
+		transfers[transfer.TransactionHash] = append(transfers[transfer.TransactionHash], transfer)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return transfers, nil
+}
+
+// GetMetadata returns the cached metadata of the given tokens keyed by address.
+func (m *TokenTransferModel) GetMetadata(addresses []string) (map[string]*TokenMetadata, error) {
+	query := `
+		SELECT address, name, symbol, decimals, fetchedAt
+		FROM token_metadata
+		WHERE address = ANY($1)
+	`
+	rows, err := m.DB.Query(query, pq.Array(addresses))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	metadata := make(map[string]*TokenMetadata)
+	for rows.Next() {
+		token := &TokenMetadata{}
+		err := rows.Scan(&token.Address, &token.Name, &token.Symbol, &token.Decimals, &token.FetchedAt)
+		if err != nil {
+			return nil, err
+		}
+		metadata[token.Address] = token
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return metadata, nil
+}
+
+func (m *TokenTransferModel) UpsertMetadata(token *TokenMetadata) error {
+	query := `
+		INSERT INTO token_metadata (address, name, symbol, decimals)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (address) DO UPDATE
+		SET name = EXCLUDED.name, symbol = EXCLUDED.symbol, decimals = EXCLUDED.decimals, fetchedAt = NOW()
+		RETURNING fetchedAt
+	`
+	return m.DB.QueryRow(query, token.Address, token.Name, token.Symbol, token.Decimals).Scan(&token.FetchedAt)
+}
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+type TransactionLog struct {
+	ID              int      `json:"id"`
+	TransactionHash string   `json:"transactionHash"`
+	LogIndex        uint     `json:"logIndex"`
+	Address         string   `json:"address"`
+	Topics          []string `json:"topics"`
+	Data            string   `json:"data"`
+	Removed         bool     `json:"removed"`
+
+	// Decoded is set when the log matches a known contract ABI or event signature.
+	Decoded *DecodedEvent `json:"decoded,omitempty"`
+}
+
+type TransactionLogModel struct {
+	DB *sql.DB
+}
+
+func (m *TransactionLogModel) CreateTable() error {
+	_, err := m.DB.Exec(`
+		CREATE TABLE IF NOT EXISTS transaction_logs (
+			id SERIAL PRIMARY KEY,
+			transactionHash VARCHAR(66) NOT NULL,
+			logIndex INTEGER NOT NULL,
+			address VARCHAR(42) NOT NULL,
+			topics TEXT[] NOT NULL,
+			data TEXT NOT NULL,
+			removed BOOLEAN NOT NULL DEFAULT FALSE,
+			UNIQUE (transactionHash, logIndex)
+		)
+	`)
+	return err
+}
+
+// InsertMany stores the logs of a transaction, replacing logs already stored
+// under the same transaction hash and log index.
+func (m *TransactionLogModel) InsertMany(logs []*TransactionLog) error {
+	query := `
+		INSERT INTO transaction_logs (transactionHash, logIndex, address, topics, data, removed)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (transactionHash, logIndex) DO UPDATE
+		SET address = EXCLUDED.address, topics = EXCLUDED.topics, data = EXCLUDED.data, removed = EXCLUDED.removed
+		RETURNING id
+	`
+	for _, log := range logs {
+		err := m.DB.QueryRow(query, log.TransactionHash, log.LogIndex, log.Address, pq.Array(log.Topics), log.Data, log.Removed).Scan(&log.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *TransactionLogModel) DeleteByTransactionHash(hash string) error {
+	_, err := m.DB.Exec(`DELETE FROM transaction_logs WHERE transactionHash = $1`, hash)
+	return err
+}
+
+// GetByTransactionHashes returns the stored logs grouped by transaction hash,
+// ordered by log index.
+func (m *TransactionLogModel) GetByTransactionHashes(hashes []string) (map[string][]*TransactionLog, error) {
+	query := `
+		SELECT id, transactionHash, logIndex, address, topics, data, removed
+		FROM transaction_logs
+		WHERE transactionHash = ANY($1)
+		ORDER BY transactionHash, logIndex
+	`
+	rows, err := m.DB.Query(query, pq.Array(hashes))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	logs := make(map[string][]*TransactionLog)
+	for rows.Next() {
+		log := &TransactionLog{}
+		var topics pq.StringArray
+		err := rows.Scan(&log.ID, &log.TransactionHash, &log.LogIndex, &log.Address, &topics, &log.Data, &log.Removed)
+		if err != nil {
+			return nil, err
+		}
+		log.Topics = topics
+		logs[log.TransactionHash] = append(logs[log.TransactionHash], log)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return logs, nil
+}
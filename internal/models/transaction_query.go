@@ -0,0 +1,207 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	SortByID          = "id"
+	SortByBlockNumber = "blockNumber"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// TransactionQuery describes a filtered, sorted page of stored transactions.
+// Address filters expect checksummed addresses, as they are stored.
+type TransactionQuery struct {
+	From            string
+	To              string
+	ContractAddress string
+	// Address matches transactions where it is the sender, the recipient or the created contract.
+	Address    string
+	FromBlock  *uint64
+	ToBlock    *uint64
+	Status     *int
+	SortBy     string
+	Descending bool
+	Cursor     string
+	Limit      int
+}
+
+// TransactionPage is one page of a TransactionQuery. NextCursor is empty on the last page.
+type TransactionPage struct {
+	Transactions []*Transaction `json:"transactions"`
+	NextCursor   string         `json:"nextCursor,omitempty"`
+}
+
+type transactionCursor struct {
+	ID          int    `json:"i"`
+	BlockNumber uint64 `json:"b"`
+	Sort        string `json:"s"`
+}
+
+// queryBuilder collects WHERE conditions and numbers their placeholders.
+type queryBuilder struct {
+	conditions []string
+	args       []interface{}
+}
+
+// where adds a condition in which every ? is replaced by the next placeholder.
+func (b *queryBuilder) where(condition string, args ...interface{}) {
+	for _, arg := range args {
+		b.args = append(b.args, arg)
+		condition = strings.Replace(condition, "?", fmt.Sprintf("$%d", len(b.args)), 1)
+	}
+	b.conditions = append(b.conditions, condition)
+}
+
+func (b *queryBuilder) whereClause() string {
+	if len(b.conditions) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(b.conditions, " AND ")
+}
+
+func (q *TransactionQuery) sortKey() string {
+	direction := "asc"
+	if q.Descending {
+		direction = "desc"
+	}
+	return q.sortColumn() + "-" + direction
+}
+
+func (q *TransactionQuery) sortColumn() string {
+	if q.SortBy == SortByBlockNumber {
+		return SortByBlockNumber
+	}
+	return SortByID
+}
+
+// filters adds the conditions shared by the page and the count queries.
+func (q *TransactionQuery) filters() *queryBuilder {
+	b := &queryBuilder{}
+	if q.From != "" {
+		b.where("fromAddress = ?", q.From)
+	}
+	if q.To != "" {
+		b.where("toAddress = ?", q.To)
+	}
+	if q.ContractAddress != "" {
+		b.where("contractAddress = ?", q.ContractAddress)
+	}
+	if q.Address != "" {
+		b.where("(fromAddress = ? OR toAddress = ? OR contractAddress = ?)", q.Address, q.Address, q.Address)
+	}
+	if q.FromBlock != nil {
+		b.where("blockNumber >= ?", *q.FromBlock)
+	}
+	if q.ToBlock != nil {
+		b.where("blockNumber <= ?", *q.ToBlock)
+	}
+	if q.Status != nil {
+		b.where("transactionStatus = ?", *q.Status)
+	}
+	return b
+}
+
+func (q *TransactionQuery) build() (string, []interface{}, error) {
+	b := q.filters()
+
+	comparison := ">"
+	direction := "ASC"
+	if q.Descending {
+		comparison = "<"
+		direction = "DESC"
+	}
+
+	if q.Cursor != "" {
+		cursor, err := decodeTransactionCursor(q.Cursor)
+		if err != nil || cursor.Sort != q.sortKey() {
+			return "", nil, ErrInvalidCursor
+		}
+
+		if q.sortColumn() == SortByBlockNumber {
+			b.where("(blockNumber, id) "+comparison+" (?, ?)", cursor.BlockNumber, cursor.ID)
+		} else {
+			b.where("id "+comparison+" ?", cursor.ID)
+		}
+	}
+
+	orderBy := "id " + direction
+	if q.sortColumn() == SortByBlockNumber {
+		orderBy = "blockNumber " + direction + ", id " + direction
+	}
+
+	// One extra row tells whether there is a next page.
+	b.args = append(b.args, q.Limit+1)
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM transactions
+		%s
+		ORDER BY %s
+		LIMIT $%d
+	`, transactionColumns, b.whereClause(), orderBy, len(b.args))
+
+	return query, b.args, nil
+}
+
+// Find returns the page of transactions described by q.
+func (m *TransactionModel) Find(q *TransactionQuery) (*TransactionPage, error) {
+	query, args, err := q.build()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := m.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transactions, err := m.scanTransactions(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &TransactionPage{Transactions: transactions}
+	if len(transactions) > q.Limit {
+		page.Transactions = transactions[:q.Limit]
+		last := page.Transactions[q.Limit-1]
+		page.NextCursor = encodeTransactionCursor(transactionCursor{ID: last.ID, BlockNumber: last.BlockNumber, Sort: q.sortKey()})
+	}
+
+	return page, nil
+}
+
+// Count returns the number of transactions matching the filters of q, ignoring
+// its cursor and limit.
+func (m *TransactionModel) Count(q *TransactionQuery) (int, error) {
+	b := q.filters()
+
+	var count int
+	err := m.DB.QueryRow("SELECT COUNT(*) FROM transactions "+b.whereClause(), b.args...).Scan(&count)
+	return count, err
+}
+
+func encodeTransactionCursor(cursor transactionCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeTransactionCursor(encoded string) (*transactionCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	cursor := &transactionCursor{}
+	err = json.Unmarshal(data, cursor)
+	if err != nil {
+		return nil, err
+	}
+	return cursor, nil
+}
@@ -2,29 +2,86 @@ package models
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 
 	"github.com/lib/pq"
 )
 
 type Transaction struct {
-	ID                int    `json:"id"`
-	TransactionHash   string `json:"transactionHash"`
-	TransactionStatus int    `json:"transactionStatus"`
-	BlockHash         string `json:"blockHash"`
-	BlockNumber       uint64 `json:"blockNumber"`
-	From              string `json:"from"`
-	To                string `json:"to"`
-	ContractAddress   string `json:"contractAddress"`
-	LogsCount         int    `json:"logsCount"`
-	Input             string `json:"input"`
-	Value             string `json:"value"`
+	ID                   int     `json:"id"`
+	TransactionHash      string  `json:"transactionHash"`
+	TransactionStatus    int     `json:"transactionStatus"`
+	BlockHash            string  `json:"blockHash"`
+	BlockNumber          uint64  `json:"blockNumber"`
+	From                 string  `json:"from"`
+	To                   *string `json:"to"`
+	ContractAddress      string  `json:"contractAddress"`
+	LogsCount            int     `json:"logsCount"`
+	Input                string  `json:"input"`
+	Value                string  `json:"value"`
+	Type                 int     `json:"type"`
+	Nonce                uint64  `json:"nonce"`
+	TransactionIndex     uint    `json:"transactionIndex"`
+	GasLimit             uint64  `json:"gasLimit"`
+	GasUsed              uint64  `json:"gasUsed"`
+	CumulativeGasUsed    uint64  `json:"cumulativeGasUsed"`
+	EffectiveGasPrice    string  `json:"effectiveGasPrice"`
+	MaxFeePerGas         *string `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas *string `json:"maxPriorityFeePerGas"`
+	Fee                  string  `json:"fee"`
+	BlockTimestamp       uint64  `json:"blockTimestamp"`
+
+	// AuthorizationList holds the authorizations of an EIP-7702 set-code
+	// transaction.
+	AuthorizationList []*SetCodeAuthorization `json:"authorizationList,omitempty"`
+
+	// Finalized is set once the block is deep enough below the head that the
+	// transaction is no longer re-checked for reorgs.
+	Finalized bool `json:"finalized"`
+
+	// Confirmations is computed from the current head when responding, and nil
+	// when the head is unknown.
+	Confirmations *uint64 `json:"confirmations"`
+
+	// DecodedInput is set when the input matches a known contract ABI or selector.
+	DecodedInput *DecodedCall `json:"decodedInput,omitempty"`
+
+	// TokenTransfers lists the ERC-20 and ERC-721 transfers emitted by the transaction.
+	TokenTransfers []*TokenTransfer `json:"tokenTransfers,omitempty"`
+
+	// Logs is only populated when a caller asks for logs inline.
+	Logs []*TransactionLog `json:"logs,omitempty"`
+
+	// NeedsBackfill is set for rows stored before the gas and fee columns existed.
+	NeedsBackfill bool `json:"-"`
+}
+
+// SetCodeAuthorization is an EIP-7702 authorization to set the code of the
+// authority account to a delegation to Address. Authority is nil when the
+// signature of the authorization is invalid, in which case the chain skipped it.
+type SetCodeAuthorization struct {
+	ChainID   string  `json:"chainId"`
+	Address   string  `json:"address"`
+	Nonce     uint64  `json:"nonce"`
+	Authority *string `json:"authority"`
 }
 
 type TransactionModel struct {
 	DB *sql.DB
 }
 
+// transactionColumns lists the columns read by scanTransaction. Rows stored
+// before the gas and fee columns were added have NULLs there and are flagged
+// with needsBackfill.
+const transactionColumns = `
+	id, transactionHash, transactionStatus, blockHash, blockNumber, fromAddress, toAddress, contractAddress, logsCount, input, value,
+	COALESCE(transactionType, 0), COALESCE(nonce, 0), COALESCE(transactionIndex, 0),
+	COALESCE(gasLimit, 0), COALESCE(gasUsed, 0), COALESCE(cumulativeGasUsed, 0), COALESCE(effectiveGasPrice, ''),
+	maxFeePerGas, maxPriorityFeePerGas, COALESCE(fee, ''), COALESCE(blockTimestamp, 0), authorizationList, finalized,
+	gasLimit IS NULL
+`
+
 func (m *TransactionModel) CreateTable() error {
 	_, err := m.DB.Exec(`
 		CREATE TABLE IF NOT EXISTS transactions (
@@ -41,26 +98,106 @@ func (m *TransactionModel) CreateTable() error {
 			value TEXT
 		)
 	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = m.DB.Exec(`
+		ALTER TABLE transactions
+			ADD COLUMN IF NOT EXISTS transactionType INTEGER,
+			ADD COLUMN IF NOT EXISTS nonce BIGINT,
+			ADD COLUMN IF NOT EXISTS transactionIndex INTEGER,
+			ADD COLUMN IF NOT EXISTS gasLimit BIGINT,
+			ADD COLUMN IF NOT EXISTS gasUsed BIGINT,
+			ADD COLUMN IF NOT EXISTS cumulativeGasUsed BIGINT,
+			ADD COLUMN IF NOT EXISTS effectiveGasPrice TEXT,
+			ADD COLUMN IF NOT EXISTS maxFeePerGas TEXT,
+			ADD COLUMN IF NOT EXISTS maxPriorityFeePerGas TEXT,
+			ADD COLUMN IF NOT EXISTS fee TEXT,
+			ADD COLUMN IF NOT EXISTS blockTimestamp BIGINT,
+			ADD COLUMN IF NOT EXISTS finalized BOOLEAN NOT NULL DEFAULT TRUE,
+			ADD COLUMN IF NOT EXISTS authorizationList JSONB
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Rows stored before finalized existed are treated as finalized, only new
+	// rows start out unfinalized.
+	_, err = m.DB.Exec(`ALTER TABLE transactions ALTER COLUMN finalized SET DEFAULT FALSE`)
+	if err != nil {
+		return err
+	}
+
+	_, err = m.DB.Exec(`
+		CREATE INDEX IF NOT EXISTS transactions_block_number_idx ON transactions (blockNumber, id);
+		CREATE INDEX IF NOT EXISTS transactions_from_address_idx ON transactions (fromAddress);
+		CREATE INDEX IF NOT EXISTS transactions_to_address_idx ON transactions (toAddress);
+		CREATE INDEX IF NOT EXISTS transactions_contract_address_idx ON transactions (contractAddress);
+		CREATE INDEX IF NOT EXISTS transactions_unfinalized_idx ON transactions (blockNumber) WHERE NOT finalized;
+	`)
 	return err
 }
 
+// Insert stores tx and sets its ID. A row that already exists for the same hash,
+// for example one that still needs a backfill or was moved by a reorg, is
+// overwritten and becomes unfinalized again.
 func (m *TransactionModel) Insert(tx *Transaction) error {
+	var authorizationList []byte
+	if len(tx.AuthorizationList) > 0 {
+		var err error
+		authorizationList, err = json.Marshal(tx.AuthorizationList)
+		if err != nil {
+			return err
+		}
+	}
+
 	query := `
-        INSERT INTO transactions (transactionHash, transactionStatus, blockHash, blockNumber, fromAddress, toAddress, contractAddress, logsCount, input, value)
-        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+        INSERT INTO transactions (
+            transactionHash, transactionStatus, blockHash, blockNumber, fromAddress, toAddress, contractAddress, logsCount, input, value,
+            transactionType, nonce, transactionIndex, gasLimit, gasUsed, cumulativeGasUsed, effectiveGasPrice, maxFeePerGas, maxPriorityFeePerGas, fee, blockTimestamp,
+            authorizationList
+        )
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22)
+        ON CONFLICT (transactionHash) DO UPDATE SET
+            transactionStatus = EXCLUDED.transactionStatus,
+            blockHash = EXCLUDED.blockHash,
+            blockNumber = EXCLUDED.blockNumber,
+            fromAddress = EXCLUDED.fromAddress,
+            toAddress = EXCLUDED.toAddress,
+            contractAddress = EXCLUDED.contractAddress,
+            logsCount = EXCLUDED.logsCount,
+            input = EXCLUDED.input,
+            value = EXCLUDED.value,
+            transactionType = EXCLUDED.transactionType,
+            nonce = EXCLUDED.nonce,
+            transactionIndex = EXCLUDED.transactionIndex,
+            gasLimit = EXCLUDED.gasLimit,
+            gasUsed = EXCLUDED.gasUsed,
+            cumulativeGasUsed = EXCLUDED.cumulativeGasUsed,
+            effectiveGasPrice = EXCLUDED.effectiveGasPrice,
+            maxFeePerGas = EXCLUDED.maxFeePerGas,
+            maxPriorityFeePerGas = EXCLUDED.maxPriorityFeePerGas,
+            fee = EXCLUDED.fee,
+            blockTimestamp = EXCLUDED.blockTimestamp,
+            authorizationList = EXCLUDED.authorizationList,
+            finalized = FALSE
+        RETURNING id
     `
-	_, err := m.DB.Exec(query, tx.TransactionHash, tx.TransactionStatus, tx.BlockHash, tx.BlockNumber, tx.From, tx.To, tx.ContractAddress, tx.LogsCount, tx.Input, tx.Value)
-	return err
+	return m.DB.QueryRow(query,
+		tx.TransactionHash, tx.TransactionStatus, tx.BlockHash, tx.BlockNumber, tx.From, tx.To, tx.ContractAddress, tx.LogsCount, tx.Input, tx.Value,
+		tx.Type, tx.Nonce, tx.TransactionIndex, tx.GasLimit, tx.GasUsed, tx.CumulativeGasUsed, tx.EffectiveGasPrice, tx.MaxFeePerGas, tx.MaxPriorityFeePerGas, tx.Fee, tx.BlockTimestamp,
+		authorizationList,
+	).Scan(&tx.ID)
 }
 
 func (m *TransactionModel) Get(hash string) (*Transaction, error) {
 	query := `
-		SELECT *        
+		SELECT ` + transactionColumns + `
 		FROM transactions
         WHERE transactionHash = $1
     `
-	tx := &Transaction{}
-	err := m.DB.QueryRow(query, hash).Scan(&tx.ID, &tx.TransactionHash, &tx.TransactionStatus, &tx.BlockHash, &tx.BlockNumber, &tx.From, &tx.To, &tx.ContractAddress, &tx.LogsCount, &tx.Input, &tx.Value)
+	tx, err := m.scanTransaction(m.DB.QueryRow(query, hash))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, errors.New("transaction not found")
@@ -72,20 +209,49 @@ func (m *TransactionModel) Get(hash string) (*Transaction, error) {
 
 func (m *TransactionModel) GetMultipleByIDs(ids []int) ([]*Transaction, error) {
 	query := `
-        SELECT *
+        SELECT ` + transactionColumns + `
         FROM transactions
         WHERE id = ANY($1)
     `
 	return m.getMultipleTransactions(query, pq.Array(ids))
 }
 
-func (m *TransactionModel) GetAll() ([]*Transaction, error) {
+// GetUnfinalized returns up to limit transactions that are not finalized yet,
+// ordered by block number and id, starting after the position (afterBlock,
+// afterID). Passing the block number and id of the last row of a page returns
+// the next page; passing (fromBlock, 0) returns the first page from fromBlock.
+func (m *TransactionModel) GetUnfinalized(afterBlock uint64, afterID, limit int) ([]*Transaction, error) {
 	query := `
-		SELECT *
-		FROM transactions
-		ORDER BY id
-	`
-	return m.getMultipleTransactions(query, nil)
+        SELECT ` + transactionColumns + `
+        FROM transactions
+        WHERE NOT finalized AND (blockNumber, id) > ($1, $2)
+        ORDER BY blockNumber, id
+        LIMIT $3
+    `
+	rows, err := m.DB.Query(query, afterBlock, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return m.scanTransactions(rows)
+}
+
+// FinalizeBefore marks the transactions mined before block as finalized.
+func (m *TransactionModel) FinalizeBefore(block uint64) error {
+	_, err := m.DB.Exec(`UPDATE transactions SET finalized = TRUE WHERE NOT finalized AND blockNumber < $1`, block)
+	return err
+}
+
+// MarkFinalized finalizes the transactions stored under blockHash.
+func (m *TransactionModel) MarkFinalized(blockHash string) error {
+	_, err := m.DB.Exec(`UPDATE transactions SET finalized = TRUE WHERE blockHash = $1`, blockHash)
+	return err
+}
+
+func (m *TransactionModel) Delete(hash string) error {
+	_, err := m.DB.Exec(`DELETE FROM transactions WHERE transactionHash = $1`, hash)
+	return err
 }
 
 func (m *TransactionModel) getMultipleTransactions(query string, param interface{}) ([]*Transaction, error) {
@@ -108,20 +274,7 @@ func (m *TransactionModel) getMultipleTransactions(query string, param interface
 func (m *TransactionModel) scanTransactions(rows *sql.Rows) ([]*Transaction, error) {
 	transactions := []*Transaction{}
 	for rows.Next() {
-		tx := &Transaction{}
-		err := rows.Scan(
-			&tx.ID,
-			&tx.TransactionHash,
-			&tx.TransactionStatus,
-			&tx.BlockHash,
-			&tx.BlockNumber,
-			&tx.From,
-			&tx.To,
-			&tx.ContractAddress,
-			&tx.LogsCount,
-			&tx.Input,
-			&tx.Value,
-		)
+		tx, err := m.scanTransaction(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -132,3 +285,50 @@ func (m *TransactionModel) scanTransactions(rows *sql.Rows) ([]*Transaction, err
 	}
 	return transactions, nil
 }
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func (m *TransactionModel) scanTransaction(row rowScanner) (*Transaction, error) {
+	tx := &Transaction{}
+	var authorizationList []byte
+	err := row.Scan(
+		&tx.ID,
+		&tx.TransactionHash,
+		&tx.TransactionStatus,
+		&tx.BlockHash,
+		&tx.BlockNumber,
+		&tx.From,
+		&tx.To,
+		&tx.ContractAddress,
+		&tx.LogsCount,
+		&tx.Input,
+		&tx.Value,
+		&tx.Type,
+		&tx.Nonce,
+		&tx.TransactionIndex,
+		&tx.GasLimit,
+		&tx.GasUsed,
+		&tx.CumulativeGasUsed,
+		&tx.EffectiveGasPrice,
+		&tx.MaxFeePerGas,
+		&tx.MaxPriorityFeePerGas,
+		&tx.Fee,
+		&tx.BlockTimestamp,
+		&authorizationList,
+		&tx.Finalized,
+		&tx.NeedsBackfill,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if authorizationList != nil {
+		err = json.Unmarshal(authorizationList, &tx.AuthorizationList)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return tx, nil
+}
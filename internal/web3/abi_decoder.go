@@ -0,0 +1,223 @@
+package web3
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+
+	"eth-fetcher.ddzhalev.net/internal/models"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+var ErrUnknownSignature = errors.New("unknown method or event signature")
+
+// erc20ABI covers the common ERC-20 methods and events. approve and transferFrom
+// share their selectors with ERC-721, so those calls are decoded with ERC-20
+// argument names.
+const erc20ABI = `[
+	{"type":"function","name":"transfer","inputs":[{"name":"to","type":"address"},{"name":"value","type":"uint256"}]},
+	{"type":"function","name":"approve","inputs":[{"name":"spender","type":"address"},{"name":"value","type":"uint256"}]},
+	{"type":"function","name":"transferFrom","inputs":[{"name":"from","type":"address"},{"name":"to","type":"address"},{"name":"value","type":"uint256"}]},
+	{"type":"function","name":"deposit","inputs":[]},
+	{"type":"function","name":"withdraw","inputs":[{"name":"value","type":"uint256"}]},
+	{"type":"event","name":"Transfer","inputs":[{"name":"from","type":"address","indexed":true},{"name":"to","type":"address","indexed":true},{"name":"value","type":"uint256","indexed":false}]},
+	{"type":"event","name":"Approval","inputs":[{"name":"owner","type":"address","indexed":true},{"name":"spender","type":"address","indexed":true},{"name":"value","type":"uint256","indexed":false}]}
+]`
+
+// erc721ABI covers the ERC-721 methods and events not already in erc20ABI. Its
+// Transfer and Approval events share their IDs with ERC-20 but index the token ID.
+const erc721ABI = `[
+	{"type":"function","name":"safeTransferFrom","inputs":[{"name":"from","type":"address"},{"name":"to","type":"address"},{"name":"tokenId","type":"uint256"}]},
+	{"type":"function","name":"safeTransferFrom","inputs":[{"name":"from","type":"address"},{"name":"to","type":"address"},{"name":"tokenId","type":"uint256"},{"name":"data","type":"bytes"}]},
+	{"type":"function","name":"setApprovalForAll","inputs":[{"name":"operator","type":"address"},{"name":"approved","type":"bool"}]},
+	{"type":"event","name":"Transfer","inputs":[{"name":"from","type":"address","indexed":true},{"name":"to","type":"address","indexed":true},{"name":"tokenId","type":"uint256","indexed":true}]},
+	{"type":"event","name":"Approval","inputs":[{"name":"owner","type":"address","indexed":true},{"name":"approved","type":"address","indexed":true},{"name":"tokenId","type":"uint256","indexed":true}]},
+	{"type":"event","name":"ApprovalForAll","inputs":[{"name":"owner","type":"address","indexed":true},{"name":"operator","type":"address","indexed":true},{"name":"approved","type":"bool","indexed":false}]}
+]`
+
+var (
+	builtinERC20ABI  = mustParseABI(erc20ABI)
+	builtinERC721ABI = mustParseABI(erc721ABI)
+)
+
+func mustParseABI(definition string) *abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(definition))
+	if err != nil {
+		panic(err)
+	}
+	return &parsed
+}
+
+// ParseABI parses a contract ABI in its JSON representation.
+func ParseABI(definition string) (*abi.ABI, error) {
+	parsed, err := abi.JSON(strings.NewReader(definition))
+	if err != nil {
+		return nil, err
+	}
+	return &parsed, nil
+}
+
+// DecodeInput decodes transaction calldata into the called method and its named
+// arguments. contractABI may be nil, in which case only the built-in ERC-20 and
+// ERC-721 selectors are recognized.
+func DecodeInput(contractABI *abi.ABI, data []byte) (*models.DecodedCall, error) {
+	if len(data) < 4 {
+		return nil, ErrUnknownSignature
+	}
+
+	for _, candidate := range []*abi.ABI{contractABI, builtinERC20ABI, builtinERC721ABI} {
+		if candidate == nil {
+			continue
+		}
+
+		method, err := candidate.MethodById(data[:4])
+		if err != nil {
+			continue
+		}
+
+		arguments := make(map[string]interface{})
+		err = namedArguments(method.Inputs).UnpackIntoMap(arguments, data[4:])
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode arguments of %s: %w", method.Sig, err)
+		}
+
+		return &models.DecodedCall{
+			Method:    method.RawName,
+			Signature: method.Sig,
+			Arguments: formatABIValues(arguments),
+		}, nil
+	}
+
+	return nil, ErrUnknownSignature
+}
+
+// DecodeLog decodes an event log into the event name and its named fields.
+// contractABI may be nil, in which case only the built-in ERC-20 and ERC-721
+// events are recognized.
+func DecodeLog(contractABI *abi.ABI, topics []common.Hash, data []byte) (*models.DecodedEvent, error) {
+	if len(topics) == 0 {
+		return nil, ErrUnknownSignature
+	}
+
+	candidates := []*abi.ABI{contractABI, builtinERC20ABI, builtinERC721ABI}
+	if len(topics) == 4 {
+		candidates = []*abi.ABI{contractABI, builtinERC721ABI, builtinERC20ABI}
+	}
+
+	for _, candidate := range candidates {
+		if candidate == nil {
+			continue
+		}
+
+		event, err := candidate.EventByID(topics[0])
+		if err != nil {
+			continue
+		}
+
+		inputs := namedArguments(event.Inputs)
+		var indexed abi.Arguments
+		for _, input := range inputs {
+			if input.Indexed {
+				indexed = append(indexed, input)
+			}
+		}
+
+		if len(indexed) != len(topics)-1 {
+			continue
+		}
+
+		fields := make(map[string]interface{})
+		err = abi.ParseTopicsIntoMap(fields, indexed, topics[1:])
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode topics of %s: %w", event.Sig, err)
+		}
+
+		err = inputs.NonIndexed().UnpackIntoMap(fields, data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode data of %s: %w", event.Sig, err)
+		}
+
+		return &models.DecodedEvent{
+			Event:     event.RawName,
+			Signature: event.Sig,
+			Fields:    formatABIValues(fields),
+		}, nil
+	}
+
+	return nil, ErrUnknownSignature
+}
+
+// namedArguments returns a copy of arguments where unnamed ones are called argN.
+func namedArguments(arguments abi.Arguments) abi.Arguments {
+	named := make(abi.Arguments, len(arguments))
+	copy(named, arguments)
+	for i := range named {
+		if named[i].Name == "" {
+			named[i].Name = fmt.Sprintf("arg%d", i)
+		}
+	}
+	return named
+}
+
+func formatABIValues(values map[string]interface{}) map[string]interface{} {
+	for name, value := range values {
+		values[name] = formatABIValue(reflect.ValueOf(value))
+	}
+	return values
+}
+
+// formatABIValue converts decoded values into JSON friendly ones: integers become
+// decimal strings so large values keep their precision, and bytes become hex.
+func formatABIValue(value reflect.Value) interface{} {
+	if !value.IsValid() {
+		return nil
+	}
+
+	switch v := value.Interface().(type) {
+	case *big.Int:
+		return v.String()
+	case common.Address:
+		return v.Hex()
+	case common.Hash:
+		return v.Hex()
+	case []byte:
+		return hexutil.Encode(v)
+	}
+
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return fmt.Sprint(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return fmt.Sprint(value.Uint())
+	case reflect.Array:
+		if value.Type().Elem().Kind() == reflect.Uint8 {
+			bytes := make([]byte, value.Len())
+			reflect.Copy(reflect.ValueOf(bytes), value)
+			return hexutil.Encode(bytes)
+		}
+		fallthrough
+	case reflect.Slice:
+		items := make([]interface{}, value.Len())
+		for i := range items {
+			items[i] = formatABIValue(value.Index(i))
+		}
+		return items
+	case reflect.Struct:
+		fields := make(map[string]interface{})
+		for i := 0; i < value.NumField(); i++ {
+			field := value.Type().Field(i)
+			name := field.Tag.Get("json")
+			if name == "" {
+				name = field.Name
+			}
+			fields[name] = formatABIValue(value.Field(i))
+		}
+		return fields
+	}
+
+	return value.Interface()
+}
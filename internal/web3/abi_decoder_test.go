@@ -0,0 +1,45 @@
+package web3
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestFormatABIValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  interface{}
+	}{
+		{name: "uint8", value: uint8(18), want: "18"},
+		{name: "uint", value: uint(7), want: "7"},
+		{name: "uint64", value: uint64(1 << 40), want: "1099511627776"},
+		{name: "int32", value: int32(-5), want: "-5"},
+		{name: "big int", value: new(big.Int).Lsh(big.NewInt(1), 200), want: new(big.Int).Lsh(big.NewInt(1), 200).String()},
+		{name: "bool", value: true, want: true},
+		{name: "address", value: common.HexToAddress("0x01"), want: "0x0000000000000000000000000000000000000001"},
+		{name: "bytes", value: []byte{0xca, 0xfe}, want: "0xcafe"},
+		{name: "bytes4", value: [4]byte{0xde, 0xad, 0xbe, 0xef}, want: "0xdeadbeef"},
+		{name: "uint16 slice", value: []uint16{1, 2}, want: []interface{}{"1", "2"}},
+		{
+			name: "tuple",
+			value: struct {
+				Decimals uint8  `json:"decimals"`
+				Symbol   string `json:"symbol"`
+			}{Decimals: 6, Symbol: "USDC"},
+			want: map[string]interface{}{"decimals": "6", "symbol": "USDC"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := formatABIValue(reflect.ValueOf(tt.value))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("formatABIValue(%v) = %#v, want %#v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package web3
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// BlockSummary is a block header with the hashes of the block's transactions.
+// Unlike a full types.Block it can be decoded even when the block contains
+// transaction types go-ethereum does not support, such as L2 deposit transactions.
+type BlockSummary struct {
+	Hash              common.Hash
+	Header            *types.Header
+	TransactionHashes []common.Hash
+}
+
+// FetchBlockByNumber returns the summary of the block with the given number, or of
+// the latest block if number is nil.
+func FetchBlockByNumber(ctx context.Context, client *rpc.Client, number *big.Int) (*BlockSummary, error) {
+	blockNumber := "latest"
+	if number != nil {
+		blockNumber = hexutil.EncodeBig(number)
+	}
+	return fetchBlockSummary(ctx, client, "eth_getBlockByNumber", blockNumber)
+}
+
+// FetchBlockByHash returns the summary of the block with the given hash.
+func FetchBlockByHash(ctx context.Context, client *rpc.Client, hash common.Hash) (*BlockSummary, error) {
+	return fetchBlockSummary(ctx, client, "eth_getBlockByHash", hash)
+}
+
+func fetchBlockSummary(ctx context.Context, client *rpc.Client, method string, blockID interface{}) (*BlockSummary, error) {
+	var raw json.RawMessage
+	err := client.CallContext(ctx, &raw, method, blockID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, ethereum.NotFound
+	}
+
+	header := &types.Header{}
+	err = json.Unmarshal(raw, header)
+	if err != nil {
+		return nil, err
+	}
+
+	// The hash is taken from the node rather than computed from the header, as
+	// chains with extra header fields would hash differently.
+	var body struct {
+		Hash         common.Hash   `json:"hash"`
+		Transactions []common.Hash `json:"transactions"`
+	}
+	err = json.Unmarshal(raw, &body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BlockSummary{Hash: body.Hash, Header: header, TransactionHashes: body.Transactions}, nil
+}
+
+// BlockTransaction identifies a transaction of a block by its hash and the
+// addresses it was sent from and to. To is nil for contract creations.
+type BlockTransaction struct {
+	Hash common.Hash     `json:"hash"`
+	From common.Address  `json:"from"`
+	To   *common.Address `json:"to"`
+}
+
+// FetchBlockTransactions returns the transactions of the block with the given number.
+func FetchBlockTransactions(ctx context.Context, client *rpc.Client, number *big.Int) ([]BlockTransaction, error) {
+	var block *struct {
+		Transactions []BlockTransaction `json:"transactions"`
+	}
+	err := client.CallContext(ctx, &block, "eth_getBlockByNumber", hexutil.EncodeBig(number), true)
+	if err != nil {
+		return nil, err
+	}
+
+	if block == nil {
+		return nil, ethereum.NotFound
+	}
+	return block.Transactions, nil
+}
@@ -0,0 +1,25 @@
+package web3
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+var chainConfigs = map[uint64]*params.ChainConfig{
+	params.MainnetChainConfig.ChainID.Uint64(): params.MainnetChainConfig,
+	params.SepoliaChainConfig.ChainID.Uint64(): params.SepoliaChainConfig,
+	params.HoleskyChainConfig.ChainID.Uint64(): params.HoleskyChainConfig,
+}
+
+// BlockSigner returns the signer able to recover senders of the transactions
+// included in the given block. Forks are resolved from the chain config for
+// known chains; for other chains the latest signer is used, which still accepts
+// every older transaction type including unprotected legacy transactions.
+func BlockSigner(chainID *big.Int, header *types.Header) types.Signer {
+	if config, ok := chainConfigs[chainID.Uint64()]; ok && header != nil {
+		return types.MakeSigner(config, header.Number, header.Time)
+	}
+	return types.LatestSignerForChainID(chainID)
+}
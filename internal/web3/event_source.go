@@ -0,0 +1,196 @@
+package web3
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/event"
+)
+
+// EventSource delivers new chain heads and PersonInfoUpdated events, either from
+// websocket subscriptions or by polling an HTTP endpoint, so both feed the same
+// listeners.
+type EventSource interface {
+	// Name identifies the kind of source, "websocket" or "polling".
+	Name() string
+	SubscribePersonInfoUpdated(ctx context.Context, sink chan<- *SimplePersonInfoContractPersonInfoUpdated) (ethereum.Subscription, error)
+	SubscribeNewHeads(ctx context.Context, sink chan<- *types.Header) (ethereum.Subscription, error)
+	// Reconnect replaces the underlying connection after a failure. Existing
+	// subscriptions end with an error.
+	Reconnect(ctx context.Context) error
+}
+
+// PollingConfig configures the polling event source used when ETH_SOCKET_URL is not set.
+type PollingConfig struct {
+	Interval time.Duration
+	// MaxBlockRange is the maximum number of blocks queried per eth_getLogs call.
+	MaxBlockRange uint64
+}
+
+type websocketEventSource struct {
+	url    string
+	mu     sync.Mutex
+	client *ethclient.Client
+}
+
+func newWebsocketEventSource(url string) (*websocketEventSource, error) {
+	client, err := ethclient.Dial(url)
+	if err != nil {
+		return nil, err
+	}
+	return &websocketEventSource{url: url, client: client}, nil
+}
+
+func (s *websocketEventSource) Name() string {
+	return "websocket"
+}
+
+func (s *websocketEventSource) SubscribePersonInfoUpdated(ctx context.Context, sink chan<- *SimplePersonInfoContractPersonInfoUpdated) (ethereum.Subscription, error) {
+	contract, err := newContractInstance(s.currentClient())
+	if err != nil {
+		return nil, err
+	}
+	return contract.WatchPersonInfoUpdated(&bind.WatchOpts{Context: ctx}, sink, nil)
+}
+
+func (s *websocketEventSource) SubscribeNewHeads(ctx context.Context, sink chan<- *types.Header) (ethereum.Subscription, error) {
+	return s.currentClient().SubscribeNewHead(ctx, sink)
+}
+
+func (s *websocketEventSource) Reconnect(ctx context.Context) error {
+	client, err := ethclient.DialContext(ctx, s.url)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	old := s.client
+	s.client = client
+	s.mu.Unlock()
+
+	old.Close()
+	return nil
+}
+
+func (s *websocketEventSource) currentClient() *ethclient.Client {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.client
+}
+
+// pollingEventSource emulates subscriptions by polling for new blocks and
+// querying their logs with eth_getLogs. It never reports removed logs, so
+// reorged events are only cleaned up by the reorg validator.
+type pollingEventSource struct {
+	client   *ethclient.Client
+	contract *SimplePersonInfoContract
+	config   PollingConfig
+}
+
+func newPollingEventSource(client *ethclient.Client, contract *SimplePersonInfoContract, config PollingConfig) *pollingEventSource {
+	return &pollingEventSource{client: client, contract: contract, config: config}
+}
+
+func (s *pollingEventSource) Name() string {
+	return "polling"
+}
+
+// SubscribePersonInfoUpdated delivers the events of the blocks after the head at
+// the time of the call.
+func (s *pollingEventSource) SubscribePersonInfoUpdated(ctx context.Context, sink chan<- *SimplePersonInfoContractPersonInfoUpdated) (ethereum.Subscription, error) {
+	head, err := s.client.BlockNumber(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		next := head + 1
+		return s.poll(ctx, quit, func() error {
+			latest, err := s.client.BlockNumber(ctx)
+			if err != nil {
+				return err
+			}
+
+			for next <= latest {
+				to := min(latest, next+max(s.config.MaxBlockRange, 1)-1)
+
+				iter, err := s.contract.FilterPersonInfoUpdated(&bind.FilterOpts{Start: next, End: &to, Context: ctx}, nil)
+				if err != nil {
+					return err
+				}
+
+				for iter.Next() {
+					select {
+					case sink <- iter.Event:
+					case <-quit:
+						iter.Close()
+						return nil
+					}
+				}
+				err = iter.Error()
+				iter.Close()
+				if err != nil {
+					return err
+				}
+
+				next = to + 1
+			}
+			return nil
+		})
+	}), nil
+}
+
+// SubscribeNewHeads delivers the latest header whenever the head moved forward
+// since the previous poll. Blocks produced in between polls are skipped.
+func (s *pollingEventSource) SubscribeNewHeads(ctx context.Context, sink chan<- *types.Header) (ethereum.Subscription, error) {
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		var last uint64
+		return s.poll(ctx, quit, func() error {
+			header, err := s.client.HeaderByNumber(ctx, nil)
+			if err != nil {
+				return err
+			}
+
+			if header.Number.Uint64() <= last {
+				return nil
+			}
+			last = header.Number.Uint64()
+
+			select {
+			case sink <- header:
+			case <-quit:
+			}
+			return nil
+		})
+	}), nil
+}
+
+func (s *pollingEventSource) Reconnect(ctx context.Context) error {
+	return nil
+}
+
+// poll calls fn every interval until quit is closed, ctx is cancelled or fn fails.
+func (s *pollingEventSource) poll(ctx context.Context, quit <-chan struct{}, fn func() error) error {
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-quit:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		err := fn()
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package web3
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// FeeConfig configures the gas limit and fees of the transactions sent by the
+// contract interactor.
+type FeeConfig struct {
+	// GasLimitMultiplier is applied to the estimated gas to leave a safety margin.
+	// Values below 1 are treated as 1.
+	GasLimitMultiplier float64
+	// MaxFeePerGas is the ceiling on the fee cap, in wei. Nil means no ceiling.
+	MaxFeePerGas *big.Int
+	// MaxPriorityFeePerGas is the ceiling on the tip, in wei. Nil means no ceiling.
+	MaxPriorityFeePerGas *big.Int
+	// ReplacementBumpPercent is how much a replacement raises the fees of the
+	// transaction it replaces. Values below 10 are treated as 10.
+	ReplacementBumpPercent int
+}
+
+// TransactionFees are the gas parameters chosen for a transaction. On chains
+// without a base fee only GasPrice is set; otherwise GasFeeCap and GasTipCap are.
+type TransactionFees struct {
+	GasLimit  uint64
+	GasPrice  *big.Int
+	GasFeeCap *big.Int
+	GasTipCap *big.Int
+}
+
+// GweiToWei converts an amount in gwei to wei.
+func GweiToWei(gwei float64) *big.Int {
+	wei, _ := new(big.Float).Mul(big.NewFloat(gwei), big.NewFloat(params.GWei)).Int(nil)
+	return wei
+}
+
+// suggestFees picks the fees of a transaction from the node's suggested tip and
+// the latest base fee. The fee cap leaves room for the base fee to double before
+// the transaction is included, and both values are clamped to the configured
+// ceilings. It fails if the ceiling is below the current base fee, since such a
+// transaction could not be included.
+func (pci *PersonInfoContractInteractor) suggestFees(ctx context.Context) (*TransactionFees, error) {
+	header, err := pci.httpClient.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch latest block: %w", err)
+	}
+
+	if header.BaseFee == nil {
+		gasPrice, err := pci.httpClient.SuggestGasPrice(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if pci.fees.MaxFeePerGas != nil && gasPrice.Cmp(pci.fees.MaxFeePerGas) > 0 {
+			gasPrice = new(big.Int).Set(pci.fees.MaxFeePerGas)
+		}
+		return &TransactionFees{GasPrice: gasPrice}, nil
+	}
+
+	tipCap, err := pci.httpClient.SuggestGasTipCap(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if pci.fees.MaxPriorityFeePerGas != nil && tipCap.Cmp(pci.fees.MaxPriorityFeePerGas) > 0 {
+		tipCap = new(big.Int).Set(pci.fees.MaxPriorityFeePerGas)
+	}
+
+	feeCap := new(big.Int).Add(new(big.Int).Mul(header.BaseFee, big.NewInt(2)), tipCap)
+	if pci.fees.MaxFeePerGas != nil && feeCap.Cmp(pci.fees.MaxFeePerGas) > 0 {
+		if pci.fees.MaxFeePerGas.Cmp(header.BaseFee) < 0 {
+			return nil, fmt.Errorf("%w: base fee %s is above %s", ErrFeeCeilingExceeded, header.BaseFee, pci.fees.MaxFeePerGas)
+		}
+		feeCap = new(big.Int).Set(pci.fees.MaxFeePerGas)
+	}
+	if tipCap.Cmp(feeCap) > 0 {
+		tipCap = new(big.Int).Set(feeCap)
+	}
+
+	return &TransactionFees{GasFeeCap: feeCap, GasTipCap: tipCap}, nil
+}
+
+// estimateGasLimit estimates the gas used by calling to with data at the given
+// fees and applies the configured multiplier.
+func (pci *PersonInfoContractInteractor) estimateGasLimit(ctx context.Context, to common.Address, data []byte, fees *TransactionFees) (uint64, error) {
+	gas, err := pci.httpClient.EstimateGas(ctx, ethereum.CallMsg{
+		From:      pci.address,
+		To:        &to,
+		GasPrice:  fees.GasPrice,
+		GasFeeCap: fees.GasFeeCap,
+		GasTipCap: fees.GasTipCap,
+		Data:      data,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to estimate gas: %w", err)
+	}
+
+	return uint64(float64(gas) * max(pci.fees.GasLimitMultiplier, 1)), nil
+}
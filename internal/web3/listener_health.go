@@ -0,0 +1,87 @@
+package web3
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	ListenerStateStarting     = "starting"
+	ListenerStateBackfilling  = "backfilling"
+	ListenerStateLive         = "live"
+	ListenerStateReconnecting = "reconnecting"
+)
+
+// ListenerHealth tracks the state of the event listener across reconnections.
+// It is safe for concurrent use.
+type ListenerHealth struct {
+	mu     sync.Mutex
+	status ListenerHealthStatus
+}
+
+// ListenerHealthStatus is a snapshot of ListenerHealth.
+type ListenerHealthStatus struct {
+	State              string     `json:"state"`
+	Source             string     `json:"source"`
+	LastProcessedBlock *uint64    `json:"lastProcessedBlock"`
+	LastEventAt        *time.Time `json:"lastEventAt"`
+	LiveSince          *time.Time `json:"liveSince"`
+	Reconnects         int        `json:"reconnects"`
+	LastError          string     `json:"lastError"`
+	LastErrorAt        *time.Time `json:"lastErrorAt"`
+}
+
+func NewListenerHealth() *ListenerHealth {
+	return &ListenerHealth{status: ListenerHealthStatus{State: ListenerStateStarting}}
+}
+
+func (h *ListenerHealth) setState(state string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.status.State = state
+	if state == ListenerStateLive {
+		now := time.Now()
+		h.status.LiveSince = &now
+	} else {
+		h.status.LiveSince = nil
+	}
+}
+
+func (h *ListenerHealth) setSource(source string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.status.Source = source
+}
+
+func (h *ListenerHealth) setProcessed(block uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.status.LastProcessedBlock = &block
+}
+
+func (h *ListenerHealth) recordEvent() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := time.Now()
+	h.status.LastEventAt = &now
+}
+
+// RecordFailure marks the listener as reconnecting after err stopped it.
+func (h *ListenerHealth) RecordFailure(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	h.status.State = ListenerStateReconnecting
+	h.status.LiveSince = nil
+	h.status.Reconnects++
+	h.status.LastError = err.Error()
+	h.status.LastErrorAt = &now
+}
+
+func (h *ListenerHealth) Status() ListenerHealthStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.status
+}
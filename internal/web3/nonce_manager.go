@@ -0,0 +1,170 @@
+package web3
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// NonceSource reports the next nonce of an account including its pending
+// transactions. *ethclient.Client implements it.
+type NonceSource interface {
+	PendingNonceAt(ctx context.Context, account common.Address) (uint64, error)
+}
+
+// NonceManager hands out sequential nonces for one account, so concurrent
+// transactions never share a nonce. Nonces are handed out by Next and must be
+// either confirmed with Confirm once the transaction was sent, or given back with
+// Release if it was not. Released nonces are reused before new ones, so a failed
+// send does not leave a gap. It is safe for concurrent use.
+type NonceManager struct {
+	mu       sync.Mutex
+	client   NonceSource
+	account  common.Address
+	synced   bool
+	next     uint64
+	inFlight map[uint64]bool
+	released []uint64
+}
+
+func NewNonceManager(client NonceSource, account common.Address) *NonceManager {
+	return &NonceManager{
+		client:   client,
+		account:  account,
+		inFlight: make(map[uint64]bool),
+	}
+}
+
+// Next returns the nonce for the next transaction, syncing with the node first
+// if the manager has not been synced yet.
+func (m *NonceManager) Next(ctx context.Context) (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.synced {
+		err := m.resync(ctx)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	var nonce uint64
+	if len(m.released) > 0 {
+		nonce = m.released[0]
+		m.released = m.released[1:]
+	} else {
+		nonce = m.next
+		m.next++
+	}
+
+	m.inFlight[nonce] = true
+	return nonce, nil
+}
+
+// Confirm marks nonce as used by a transaction that was sent.
+func (m *NonceManager) Confirm(nonce uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.inFlight, nonce)
+}
+
+// Release gives back a nonce whose transaction was not sent, so that it is
+// handed out again.
+func (m *NonceManager) Release(nonce uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.inFlight[nonce] {
+		return
+	}
+	delete(m.inFlight, nonce)
+
+	if nonce < m.next {
+		m.addReleased(nonce)
+	}
+}
+
+// Resync reloads the account's pending nonce from the node. Call it after a
+// send failed because of its nonce, or when a sent transaction disappeared.
+func (m *NonceManager) Resync(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.resync(ctx)
+}
+
+// resync moves the manager to the node's pending nonce. Nonces the node already
+// counts are dropped from the released ones, and when other senders used the
+// account the next nonce moves past theirs. A pending nonce below the nonces
+// handed out means the transactions using it and possibly later nonces never
+// reached the node or were dropped, which holds back every later one, so every
+// nonce from the pending one up to the next that is not in flight is handed out
+// again to fill the gaps.
+func (m *NonceManager) resync(ctx context.Context) error {
+	pending, err := m.client.PendingNonceAt(ctx, m.account)
+	if err != nil {
+		return err
+	}
+
+	m.released = slices.DeleteFunc(m.released, func(nonce uint64) bool { return nonce < pending })
+
+	if !m.synced || pending >= m.next {
+		m.next = max(m.next, pending)
+		m.synced = true
+		return nil
+	}
+
+	for nonce := pending; nonce < m.next; nonce++ {
+		if !m.inFlight[nonce] {
+			m.addReleased(nonce)
+		}
+	}
+	return nil
+}
+
+func (m *NonceManager) addReleased(nonce uint64) {
+	i, found := slices.BinarySearch(m.released, nonce)
+	if !found {
+		m.released = slices.Insert(m.released, i, nonce)
+	}
+}
+
+// IsNonceError reports whether err is a node rejection caused by the nonce of
+// the transaction, after which the nonces should be resynced.
+func IsNonceError(err error) bool {
+	return errorContains(err, "nonce too low", "nonce too high", "replacement transaction underpriced", "already known")
+}
+
+// IsNonceTooLow reports whether the node rejected a transaction because its
+// nonce was already used by a mined transaction.
+func IsNonceTooLow(err error) bool {
+	return errorContains(err, "nonce too low")
+}
+
+// IsUnderpriced reports whether the node rejected a replacement because its fees
+// were not raised enough over the transaction it replaces.
+func IsUnderpriced(err error) bool {
+	return errorContains(err, "replacement transaction underpriced")
+}
+
+// IsAlreadyKnown reports whether the node rejected a transaction because it
+// already has the same transaction.
+func IsAlreadyKnown(err error) bool {
+	return errorContains(err, "already known")
+}
+
+func errorContains(err error, reasons ...string) bool {
+	if err == nil {
+		return false
+	}
+
+	message := strings.ToLower(err.Error())
+	for _, reason := range reasons {
+		if strings.Contains(message, reason) {
+			return true
+		}
+	}
+	return false
+}
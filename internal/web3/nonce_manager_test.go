@@ -0,0 +1,380 @@
+package web3
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// fakeNonceSource reports a pending nonce set by the test.
+type fakeNonceSource struct {
+	mu      sync.Mutex
+	pending uint64
+	err     error
+}
+
+func (s *fakeNonceSource) PendingNonceAt(_ context.Context, _ common.Address) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pending, s.err
+}
+
+func (s *fakeNonceSource) setPending(pending uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending = pending
+}
+
+var testAccount = common.HexToAddress("0x00000000000000000000000000000000000000aa")
+
+func mustNext(t *testing.T, m *NonceManager) uint64 {
+	t.Helper()
+	nonce, err := m.Next(context.Background())
+	if err != nil {
+		t.Fatalf("Next failed: %v", err)
+	}
+	return nonce
+}
+
+func TestNonceManagerConcurrentNoncesAreUniqueWithoutGaps(t *testing.T) {
+	const (
+		start   = 40
+		senders = 50
+		sends   = 20
+	)
+	m := NewNonceManager(&fakeNonceSource{pending: start}, testAccount)
+
+	var mu sync.Mutex
+	var confirmed []uint64
+	var wg sync.WaitGroup
+	for i := 0; i < senders; i++ {
+		wg.Add(1)
+		go func(sender int) {
+			defer wg.Done()
+			for j := 0; j < sends; j++ {
+				// Every third attempt fails to send and gives its nonce back
+				// before retrying with a new one.
+				for attempt := 0; ; attempt++ {
+					nonce, err := m.Next(context.Background())
+					if err != nil {
+						t.Errorf("Next failed: %v", err)
+						return
+					}
+					if (sender+j+attempt)%3 == 0 && attempt == 0 {
+						m.Release(nonce)
+						continue
+					}
+					m.Confirm(nonce)
+
+					mu.Lock()
+					confirmed = append(confirmed, nonce)
+					mu.Unlock()
+					break
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	slices.Sort(confirmed)
+	if len(confirmed) != senders*sends {
+		t.Fatalf("confirmed %d nonces, want %d", len(confirmed), senders*sends)
+	}
+	for i, nonce := range confirmed {
+		if nonce != start+uint64(i) {
+			t.Fatalf("confirmed nonces are not unique and consecutive: got %d at position %d, want %d", nonce, i, start+uint64(i))
+		}
+	}
+
+	if nonce := mustNext(t, m); nonce != start+senders*sends {
+		t.Errorf("Next after all sends = %d, want %d", nonce, start+senders*sends)
+	}
+}
+
+// TestNonceManagerSimulatedChain sends transactions from concurrent senders to a
+// simulated chain and checks that every one of them is mined, so no nonce was
+// used twice or skipped.
+func TestNonceManagerSimulatedChain(t *testing.T) {
+	const senders = 25
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	account := crypto.PubkeyToAddress(key.PublicKey)
+
+	backend := simulated.NewBackend(types.GenesisAlloc{
+		account: {Balance: new(big.Int).Mul(big.NewInt(100), big.NewInt(params.Ether))},
+	})
+	defer backend.Close()
+	client := backend.Client()
+
+	ctx := context.Background()
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		t.Fatalf("failed to get chain ID: %v", err)
+	}
+	signer := types.LatestSignerForChainID(chainID)
+	m := NewNonceManager(client, account)
+
+	hashes := make([]common.Hash, senders)
+	var wg sync.WaitGroup
+	for i := 0; i < senders; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			nonce, err := m.Next(ctx)
+			if err != nil {
+				t.Errorf("Next failed: %v", err)
+				return
+			}
+
+			tx, err := types.SignNewTx(key, signer, &types.DynamicFeeTx{
+				ChainID:   chainID,
+				Nonce:     nonce,
+				GasTipCap: big.NewInt(params.GWei),
+				GasFeeCap: big.NewInt(100 * params.GWei),
+				Gas:       params.TxGas,
+				To:        &testAccount,
+				Value:     big.NewInt(int64(i + 1)),
+			})
+			if err != nil {
+				m.Release(nonce)
+				t.Errorf("failed to sign transaction: %v", err)
+				return
+			}
+
+			err = client.SendTransaction(ctx, tx)
+			if err != nil {
+				m.Release(nonce)
+				t.Errorf("failed to send transaction with nonce %d: %v", nonce, err)
+				return
+			}
+			m.Confirm(nonce)
+			hashes[i] = tx.Hash()
+		}(i)
+	}
+	wg.Wait()
+	if t.Failed() {
+		return
+	}
+
+	backend.Commit()
+
+	var nonces []uint64
+	for _, hash := range hashes {
+		receipt, err := client.TransactionReceipt(ctx, hash)
+		if err != nil {
+			t.Fatalf("transaction %s was not mined: %v", hash.Hex(), err)
+		}
+		if receipt.Status != types.ReceiptStatusSuccessful {
+			t.Errorf("transaction %s failed", hash.Hex())
+		}
+
+		tx, _, err := client.TransactionByHash(ctx, hash)
+		if err != nil {
+			t.Fatalf("failed to get transaction %s: %v", hash.Hex(), err)
+		}
+		nonces = append(nonces, tx.Nonce())
+	}
+
+	slices.Sort(nonces)
+	for i, nonce := range nonces {
+		if nonce != uint64(i) {
+			t.Fatalf("mined nonces are not 0..%d: got %d at position %d", senders-1, nonce, i)
+		}
+	}
+
+	mined, err := client.NonceAt(ctx, account, nil)
+	if err != nil {
+		t.Fatalf("failed to get the account nonce: %v", err)
+	}
+	if mined != senders {
+		t.Errorf("account nonce = %d, want %d", mined, senders)
+	}
+	if nonce := mustNext(t, m); nonce != senders {
+		t.Errorf("Next after all sends = %d, want %d", nonce, senders)
+	}
+}
+
+func TestNonceManagerReleaseReusesLowestNonce(t *testing.T) {
+	m := NewNonceManager(&fakeNonceSource{pending: 7}, testAccount)
+
+	first, second, third := mustNext(t, m), mustNext(t, m), mustNext(t, m)
+	if first != 7 || second != 8 || third != 9 {
+		t.Fatalf("Next = %d, %d, %d, want 7, 8, 9", first, second, third)
+	}
+
+	m.Release(third)
+	m.Release(second)
+	m.Confirm(first)
+	// Releasing a nonce that is not in flight is ignored.
+	m.Release(first)
+
+	for _, want := range []uint64{8, 9, 10} {
+		if nonce := mustNext(t, m); nonce != want {
+			t.Errorf("Next = %d, want %d", nonce, want)
+		}
+	}
+}
+
+func TestNonceManagerResyncFillsGap(t *testing.T) {
+	source := &fakeNonceSource{pending: 5}
+	m := NewNonceManager(source, testAccount)
+
+	for _, want := range []uint64{5, 6, 7} {
+		nonce := mustNext(t, m)
+		if nonce != want {
+			t.Fatalf("Next = %d, want %d", nonce, want)
+		}
+		m.Confirm(nonce)
+	}
+
+	// The transactions with nonces 6 and 7 were dropped, so the node is still
+	// waiting for 6 and both gaps must be filled.
+	source.setPending(6)
+	err := m.Resync(context.Background())
+	if err != nil {
+		t.Fatalf("Resync failed: %v", err)
+	}
+
+	for _, want := range []uint64{6, 7, 8} {
+		if nonce := mustNext(t, m); nonce != want {
+			t.Errorf("Next after resync = %d, want %d", nonce, want)
+		}
+	}
+}
+
+func TestNonceManagerResyncDoesNotReissueInFlightNonce(t *testing.T) {
+	source := &fakeNonceSource{pending: 3}
+	m := NewNonceManager(source, testAccount)
+
+	inFlight := mustNext(t, m)
+	m.Confirm(mustNext(t, m))
+	laterInFlight := mustNext(t, m)
+	m.Confirm(mustNext(t, m))
+
+	// The node has not seen the in-flight transactions yet, and dropped the
+	// confirmed ones.
+	source.setPending(inFlight)
+	err := m.Resync(context.Background())
+	if err != nil {
+		t.Fatalf("Resync failed: %v", err)
+	}
+
+	for _, want := range []uint64{4, 6, 7} {
+		nonce := mustNext(t, m)
+		if nonce == inFlight || nonce == laterInFlight {
+			t.Fatalf("Next reissued in-flight nonce %d", nonce)
+		}
+		if nonce != want {
+			t.Errorf("Next = %d, want %d", nonce, want)
+		}
+	}
+}
+
+func TestNonceManagerReleaseAfterNonceError(t *testing.T) {
+	source := &fakeNonceSource{pending: 10}
+	m := NewNonceManager(source, testAccount)
+
+	nonce := mustNext(t, m)
+	released := mustNext(t, m)
+	m.Confirm(nonce)
+
+	// Another sender used the account, so the node rejects the nonce. The
+	// caller gives it back and resyncs, as SubmitPersonInfo does.
+	sendErr := errors.New("nonce too low: next nonce 15, tx nonce 11")
+	if !IsNonceError(sendErr) {
+		t.Fatalf("IsNonceError(%q) = false", sendErr)
+	}
+	m.Release(released)
+	source.setPending(15)
+	err := m.Resync(context.Background())
+	if err != nil {
+		t.Fatalf("Resync failed: %v", err)
+	}
+
+	// The released nonce is below the node's pending nonce and is not reused.
+	for _, want := range []uint64{15, 16} {
+		if nonce := mustNext(t, m); nonce != want {
+			t.Errorf("Next after resync = %d, want %d", nonce, want)
+		}
+	}
+}
+
+func TestNonceManagerSyncError(t *testing.T) {
+	source := &fakeNonceSource{err: errors.New("connection refused")}
+	m := NewNonceManager(source, testAccount)
+
+	_, err := m.Next(context.Background())
+	if err == nil {
+		t.Fatal("Next succeeded without a synced nonce")
+	}
+
+	source.mu.Lock()
+	source.err, source.pending = nil, 2
+	source.mu.Unlock()
+
+	if nonce := mustNext(t, m); nonce != 2 {
+		t.Errorf("Next after the node recovered = %d, want 2", nonce)
+	}
+}
+
+func TestIsNonceError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{err: nil, want: false},
+		{err: errors.New("nonce too low"), want: true},
+		{err: errors.New("Nonce Too High"), want: true},
+		{err: errors.New("replacement transaction underpriced"), want: true},
+		{err: errors.New("already known"), want: true},
+		{err: errors.New("insufficient funds for gas * price + value"), want: false},
+		{err: errors.New("execution reverted"), want: false},
+	}
+
+	for _, tt := range tests {
+		if got := IsNonceError(tt.err); got != tt.want {
+			t.Errorf("IsNonceError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestReplacementRejections(t *testing.T) {
+	tests := []struct {
+		err          error
+		tooLow       bool
+		underpriced  bool
+		alreadyKnown bool
+	}{
+		{err: nil},
+		{err: errors.New("nonce too low: next nonce 15, tx nonce 11"), tooLow: true},
+		{err: errors.New("replacement transaction underpriced"), underpriced: true},
+		{err: errors.New("already known"), alreadyKnown: true},
+		{err: errors.New("nonce too high")},
+		{err: errors.New("insufficient funds for gas * price + value")},
+	}
+
+	for _, tt := range tests {
+		if got := IsNonceTooLow(tt.err); got != tt.tooLow {
+			t.Errorf("IsNonceTooLow(%v) = %v, want %v", tt.err, got, tt.tooLow)
+		}
+		if got := IsUnderpriced(tt.err); got != tt.underpriced {
+			t.Errorf("IsUnderpriced(%v) = %v, want %v", tt.err, got, tt.underpriced)
+		}
+		if got := IsAlreadyKnown(tt.err); got != tt.alreadyKnown {
+			t.Errorf("IsAlreadyKnown(%v) = %v, want %v", tt.err, got, tt.alreadyKnown)
+		}
+	}
+}
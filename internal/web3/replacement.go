@@ -0,0 +1,133 @@
+package web3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// minReplacementBumpPercent is the fee increase nodes require by default before
+// they accept a transaction replacing a pending one with the same nonce.
+const minReplacementBumpPercent = 10
+
+// ErrFeeCeilingExceeded is returned when a transaction would need fees above the
+// configured ceilings.
+var ErrFeeCeilingExceeded = errors.New("fees exceed the fee ceiling")
+
+// ReplaceTransaction sends a transaction with the nonce of a pending one, so
+// that whichever of them is mined first takes the place of the other. Its fees
+// are the previous fees raised by the configured bump percentage, or the
+// currently suggested fees if those are higher. As in SubmitPersonInfo, the
+// signed transaction is passed to record before it is sent.
+func (pci *PersonInfoContractInteractor) ReplaceTransaction(ctx context.Context, nonce uint64, to common.Address, data []byte, gasLimit uint64, previous *TransactionFees, record func(*types.Transaction) error) (*types.Transaction, error) {
+	suggested, err := pci.suggestFees(ctx)
+	if err != nil && !errors.Is(err, ErrFeeCeilingExceeded) {
+		return nil, err
+	}
+
+	fees, err := pci.bumpFees(previous, suggested)
+	if err != nil {
+		return nil, err
+	}
+	fees.GasLimit = gasLimit
+
+	var txData types.TxData
+	if fees.GasFeeCap != nil {
+		txData = &types.DynamicFeeTx{
+			ChainID:   pci.chainID,
+			Nonce:     nonce,
+			GasTipCap: fees.GasTipCap,
+			GasFeeCap: fees.GasFeeCap,
+			Gas:       fees.GasLimit,
+			To:        &to,
+			Value:     big.NewInt(0),
+			Data:      data,
+		}
+	} else {
+		txData = &types.LegacyTx{
+			Nonce:    nonce,
+			GasPrice: fees.GasPrice,
+			Gas:      fees.GasLimit,
+			To:       &to,
+			Value:    big.NewInt(0),
+			Data:     data,
+		}
+	}
+
+	signedTx, err := pci.signer.SignTx(ctx, types.NewTx(txData), pci.chainID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = record(signedTx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = pci.httpClient.SendTransaction(ctx, signedTx)
+	if err != nil {
+		return nil, err
+	}
+	return signedTx, nil
+}
+
+// CancelTransaction replaces the pending transaction with the given nonce by a
+// zero-value transfer from the sender to itself.
+func (pci *PersonInfoContractInteractor) CancelTransaction(ctx context.Context, nonce uint64, previous *TransactionFees, record func(*types.Transaction) error) (*types.Transaction, error) {
+	return pci.ReplaceTransaction(ctx, nonce, pci.address, nil, params.TxGas, previous, record)
+}
+
+// bumpFees raises previous by the configured bump percentage, rounding up, and
+// keeps the suggested fees where they are higher. Nodes only accept the
+// replacement if both its fee cap and its tip are bumped, so the tip may go
+// above MaxPriorityFeePerGas; the fee cap is still held to MaxFeePerGas. A
+// transaction that used a gas price on a chain with a base fee is replaced by
+// a dynamic fee transaction bumped from that price.
+func (pci *PersonInfoContractInteractor) bumpFees(previous, suggested *TransactionFees) (*TransactionFees, error) {
+	bumpPercent := max(pci.fees.ReplacementBumpPercent, minReplacementBumpPercent)
+	bump := func(value *big.Int) *big.Int {
+		bumped := new(big.Int).Mul(value, big.NewInt(int64(100+bumpPercent)))
+		bumped.Add(bumped, big.NewInt(99))
+		return bumped.Div(bumped, big.NewInt(100))
+	}
+	higher := func(a, b *big.Int) *big.Int {
+		if b != nil && b.Cmp(a) > 0 {
+			return b
+		}
+		return a
+	}
+
+	if suggested == nil {
+		suggested = &TransactionFees{}
+	}
+
+	if previous.GasFeeCap == nil && suggested.GasFeeCap == nil {
+		gasPrice := higher(bump(previous.GasPrice), suggested.GasPrice)
+		if pci.fees.MaxFeePerGas != nil && gasPrice.Cmp(pci.fees.MaxFeePerGas) > 0 {
+			return nil, fmt.Errorf("%w: gas price %s is above %s", ErrFeeCeilingExceeded, gasPrice, pci.fees.MaxFeePerGas)
+		}
+		return &TransactionFees{GasPrice: gasPrice}, nil
+	}
+
+	previousFeeCap, previousTipCap := previous.GasFeeCap, previous.GasTipCap
+	if previousFeeCap == nil {
+		previousFeeCap, previousTipCap = previous.GasPrice, previous.GasPrice
+	}
+
+	feeCap := higher(bump(previousFeeCap), suggested.GasFeeCap)
+	tipCap := higher(bump(previousTipCap), suggested.GasTipCap)
+	if tipCap.Cmp(feeCap) > 0 {
+		tipCap = feeCap
+	}
+
+	if pci.fees.MaxFeePerGas != nil && feeCap.Cmp(pci.fees.MaxFeePerGas) > 0 {
+		return nil, fmt.Errorf("%w: max fee per gas %s is above %s", ErrFeeCeilingExceeded, feeCap, pci.fees.MaxFeePerGas)
+	}
+
+	return &TransactionFees{GasFeeCap: feeCap, GasTipCap: tipCap}, nil
+}
@@ -0,0 +1,220 @@
+package web3
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Signer signs the transactions sent by the contract interactor.
+type Signer interface {
+	// Address returns the account transactions are signed for.
+	Address() common.Address
+	// SignTx returns tx signed for the chain chainID.
+	SignTx(ctx context.Context, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error)
+}
+
+// Signer types accepted in SIGNER_TYPE.
+const (
+	SignerTypeKey      = "key"
+	SignerTypeKeystore = "keystore"
+	SignerTypeRemote   = "remote"
+)
+
+// NewSignerFromEnv creates the signer selected by SIGNER_TYPE:
+//   - key (the default) signs with the hex private key in PRIVATE_KEY.
+//   - keystore signs with the encrypted key in KEYSTORE_FILE, decrypted with the
+//     passphrase stored in KEYSTORE_PASSPHRASE_FILE.
+//   - remote asks the signer at REMOTE_SIGNER_URL, such as Clef, to sign for
+//     REMOTE_SIGNER_ADDRESS with the REMOTE_SIGNER_METHOD JSON-RPC method.
+func NewSignerFromEnv(ctx context.Context) (Signer, error) {
+	switch signerType := os.Getenv("SIGNER_TYPE"); signerType {
+	case "", SignerTypeKey:
+		return NewPrivateKeySigner(os.Getenv("PRIVATE_KEY"))
+	case SignerTypeKeystore:
+		return NewKeystoreSigner(os.Getenv("KEYSTORE_FILE"), os.Getenv("KEYSTORE_PASSPHRASE_FILE"))
+	case SignerTypeRemote:
+		address := os.Getenv("REMOTE_SIGNER_ADDRESS")
+		if !common.IsHexAddress(address) {
+			return nil, fmt.Errorf("invalid REMOTE_SIGNER_ADDRESS %q", address)
+		}
+		return NewRemoteSigner(ctx, os.Getenv("REMOTE_SIGNER_URL"), os.Getenv("REMOTE_SIGNER_METHOD"), common.HexToAddress(address))
+	default:
+		return nil, fmt.Errorf("unknown SIGNER_TYPE %q", signerType)
+	}
+}
+
+type privateKeySigner struct {
+	privateKey *ecdsa.PrivateKey
+	address    common.Address
+}
+
+// NewPrivateKeySigner returns a signer for the hex encoded private key hexKey.
+func NewPrivateKeySigner(hexKey string) (Signer, error) {
+	privateKey, err := crypto.HexToECDSA(strings.TrimPrefix(hexKey, "0x"))
+	if err != nil {
+		return nil, err
+	}
+	return newPrivateKeySigner(privateKey), nil
+}
+
+func newPrivateKeySigner(privateKey *ecdsa.PrivateKey) *privateKeySigner {
+	return &privateKeySigner{
+		privateKey: privateKey,
+		address:    crypto.PubkeyToAddress(privateKey.PublicKey),
+	}
+}
+
+func (s *privateKeySigner) Address() common.Address {
+	return s.address
+}
+
+func (s *privateKeySigner) SignTx(_ context.Context, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	return types.SignTx(tx, types.LatestSignerForChainID(chainID), s.privateKey)
+}
+
+// NewKeystoreSigner returns a signer for the go-ethereum keystore file keyFile,
+// decrypted with the passphrase stored in passphraseFile. Trailing newlines of
+// the passphrase file are ignored.
+func NewKeystoreSigner(keyFile, passphraseFile string) (Signer, error) {
+	keyJSON, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keystore file: %w", err)
+	}
+
+	passphrase, err := os.ReadFile(passphraseFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keystore passphrase file: %w", err)
+	}
+
+	key, err := keystore.DecryptKey(keyJSON, strings.TrimRight(string(passphrase), "\r\n"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt keystore file: %w", err)
+	}
+	return newPrivateKeySigner(key.PrivateKey), nil
+}
+
+// DefaultRemoteSignerMethod is the Clef method used to sign transactions when no
+// other method is configured. Nodes that hold the key expose eth_signTransaction,
+// which takes the same arguments and returns the same result.
+const DefaultRemoteSignerMethod = "account_signTransaction"
+
+type remoteSigner struct {
+	client  *rpc.Client
+	method  string
+	address common.Address
+}
+
+// remoteSignArgs are the transaction arguments of account_signTransaction and
+// eth_signTransaction. Addresses are sent checksummed, as Clef expects. The
+// access list is sent for every typed transaction, since it is part of what is
+// signed.
+type remoteSignArgs struct {
+	Type                 hexutil.Uint64    `json:"type"`
+	From                 string            `json:"from"`
+	To                   *string           `json:"to"`
+	Gas                  hexutil.Uint64    `json:"gas"`
+	GasPrice             *hexutil.Big      `json:"gasPrice,omitempty"`
+	MaxFeePerGas         *hexutil.Big      `json:"maxFeePerGas,omitempty"`
+	MaxPriorityFeePerGas *hexutil.Big      `json:"maxPriorityFeePerGas,omitempty"`
+	Value                hexutil.Big       `json:"value"`
+	Nonce                hexutil.Uint64    `json:"nonce"`
+	Data                 hexutil.Bytes     `json:"data"`
+	AccessList           *types.AccessList `json:"accessList,omitempty"`
+	ChainID              *hexutil.Big      `json:"chainId"`
+}
+
+type remoteSignResult struct {
+	Raw hexutil.Bytes `json:"raw"`
+}
+
+// NewRemoteSigner returns a signer that asks the JSON-RPC signer at url to sign
+// transactions for address with method, or DefaultRemoteSignerMethod if method
+// is empty.
+func NewRemoteSigner(ctx context.Context, url, method string, address common.Address) (Signer, error) {
+	if url == "" {
+		return nil, errors.New("remote signer URL is not set")
+	}
+
+	client, err := rpc.DialContext(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to remote signer: %w", err)
+	}
+
+	if method == "" {
+		method = DefaultRemoteSignerMethod
+	}
+	return &remoteSigner{client: client, method: method, address: address}, nil
+}
+
+func (s *remoteSigner) Address() common.Address {
+	return s.address
+}
+
+// SignTx sends tx to the remote signer and checks that what it signed is tx,
+// signed by the expected account.
+func (s *remoteSigner) SignTx(ctx context.Context, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	args := remoteSignArgs{
+		Type:    hexutil.Uint64(tx.Type()),
+		From:    s.address.Hex(),
+		Gas:     hexutil.Uint64(tx.Gas()),
+		Value:   hexutil.Big(*tx.Value()),
+		Nonce:   hexutil.Uint64(tx.Nonce()),
+		Data:    tx.Data(),
+		ChainID: (*hexutil.Big)(chainID),
+	}
+	if tx.To() != nil {
+		to := tx.To().Hex()
+		args.To = &to
+	}
+	if tx.Type() != types.LegacyTxType {
+		accessList := tx.AccessList()
+		if accessList == nil {
+			accessList = types.AccessList{}
+		}
+		args.AccessList = &accessList
+	}
+	if tx.Type() >= types.DynamicFeeTxType {
+		args.MaxFeePerGas = (*hexutil.Big)(tx.GasFeeCap())
+		args.MaxPriorityFeePerGas = (*hexutil.Big)(tx.GasTipCap())
+	} else {
+		args.GasPrice = (*hexutil.Big)(tx.GasPrice())
+	}
+
+	var result remoteSignResult
+	err := s.client.CallContext(ctx, &result, s.method, args)
+	if err != nil {
+		return nil, fmt.Errorf("remote signer failed to sign transaction: %w", err)
+	}
+
+	signedTx := new(types.Transaction)
+	err = signedTx.UnmarshalBinary(result.Raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode transaction signed by remote signer: %w", err)
+	}
+
+	signer := types.LatestSignerForChainID(chainID)
+	if signer.Hash(signedTx) != signer.Hash(tx) {
+		return nil, errors.New("remote signer signed a different transaction")
+	}
+	sender, err := types.Sender(signer, signedTx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to recover remote signer address: %w", err)
+	}
+	if sender != s.address {
+		return nil, fmt.Errorf("remote signer signed for %s instead of %s", sender.Hex(), s.address.Hex())
+	}
+
+	return signedTx, nil
+}
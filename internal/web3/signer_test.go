@@ -0,0 +1,368 @@
+package web3
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"math/big"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+var testChainID = big.NewInt(11155111)
+
+func mustGenerateKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	return key
+}
+
+func newTestTransaction() *types.Transaction {
+	to := common.HexToAddress("0x5fbdb2315678afecb367f032d93f642f64180aa3")
+	return types.NewTx(&types.DynamicFeeTx{
+		ChainID:   testChainID,
+		Nonce:     12,
+		GasTipCap: big.NewInt(1_000_000_000),
+		GasFeeCap: big.NewInt(30_000_000_000),
+		Gas:       90_000,
+		To:        &to,
+		Value:     big.NewInt(0),
+		Data:      []byte{0xca, 0xfe},
+	})
+}
+
+// stubSignerService answers account_signTransaction and eth_signTransaction by
+// signing the requested transaction with key, after passing its arguments to
+// modify. Like Clef, it builds an access list transaction from a gas price and
+// an access list, and a dynamic fee transaction from fee caps.
+type stubSignerService struct {
+	key    *ecdsa.PrivateKey
+	modify func(args *remoteSignArgs)
+	args   json.RawMessage
+}
+
+func (s *stubSignerService) SignTransaction(args json.RawMessage) (*remoteSignResult, error) {
+	s.args = args
+
+	var decoded remoteSignArgs
+	err := json.Unmarshal(args, &decoded)
+	if err != nil {
+		return nil, err
+	}
+	if s.modify != nil {
+		s.modify(&decoded)
+	}
+
+	var to *common.Address
+	if decoded.To != nil {
+		address := common.HexToAddress(*decoded.To)
+		to = &address
+	}
+	var accessList types.AccessList
+	if decoded.AccessList != nil {
+		accessList = *decoded.AccessList
+	}
+
+	var txData types.TxData
+	switch {
+	case decoded.MaxFeePerGas != nil:
+		txData = &types.DynamicFeeTx{
+			ChainID:    decoded.ChainID.ToInt(),
+			Nonce:      uint64(decoded.Nonce),
+			GasTipCap:  decoded.MaxPriorityFeePerGas.ToInt(),
+			GasFeeCap:  decoded.MaxFeePerGas.ToInt(),
+			Gas:        uint64(decoded.Gas),
+			To:         to,
+			Value:      decoded.Value.ToInt(),
+			Data:       decoded.Data,
+			AccessList: accessList,
+		}
+	case decoded.AccessList != nil:
+		txData = &types.AccessListTx{
+			ChainID:    decoded.ChainID.ToInt(),
+			Nonce:      uint64(decoded.Nonce),
+			GasPrice:   decoded.GasPrice.ToInt(),
+			Gas:        uint64(decoded.Gas),
+			To:         to,
+			Value:      decoded.Value.ToInt(),
+			Data:       decoded.Data,
+			AccessList: accessList,
+		}
+	default:
+		txData = &types.LegacyTx{
+			Nonce:    uint64(decoded.Nonce),
+			GasPrice: decoded.GasPrice.ToInt(),
+			Gas:      uint64(decoded.Gas),
+			To:       to,
+			Value:    decoded.Value.ToInt(),
+			Data:     decoded.Data,
+		}
+	}
+
+	signedTx, err := types.SignNewTx(s.key, types.LatestSignerForChainID(decoded.ChainID.ToInt()), txData)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := signedTx.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return &remoteSignResult{Raw: raw}, nil
+}
+
+// newStubRemoteSigner starts a JSON-RPC server serving service under namespace
+// and returns a remote signer for address using method.
+func newStubRemoteSigner(t *testing.T, namespace, method string, service *stubSignerService, address common.Address) Signer {
+	t.Helper()
+
+	server := rpc.NewServer()
+	err := server.RegisterName(namespace, service)
+	if err != nil {
+		t.Fatalf("failed to register stub signer: %v", err)
+	}
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(func() {
+		httpServer.Close()
+		server.Stop()
+	})
+
+	signer, err := NewRemoteSigner(context.Background(), httpServer.URL, method, address)
+	if err != nil {
+		t.Fatalf("NewRemoteSigner failed: %v", err)
+	}
+	return signer
+}
+
+func TestRemoteSignerSignTx(t *testing.T) {
+	tests := []struct {
+		name      string
+		namespace string
+		method    string
+	}{
+		{name: "default method", namespace: "account", method: ""},
+		{name: "account_signTransaction", namespace: "account", method: "account_signTransaction"},
+		{name: "eth_signTransaction", namespace: "eth", method: "eth_signTransaction"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := mustGenerateKey(t)
+			address := crypto.PubkeyToAddress(key.PublicKey)
+			service := &stubSignerService{key: key}
+			signer := newStubRemoteSigner(t, tt.namespace, tt.method, service, address)
+
+			tx := newTestTransaction()
+			signedTx, err := signer.SignTx(context.Background(), tx, testChainID)
+			if err != nil {
+				t.Fatalf("SignTx failed: %v", err)
+			}
+			if signedTx.Hash() == tx.Hash() {
+				t.Error("SignTx returned the unsigned transaction")
+			}
+			sender, err := types.Sender(types.LatestSignerForChainID(testChainID), signedTx)
+			if err != nil || sender != address {
+				t.Errorf("signed transaction sender = %s (%v), want %s", sender.Hex(), err, address.Hex())
+			}
+
+			var args map[string]interface{}
+			err = json.Unmarshal(service.args, &args)
+			if err != nil {
+				t.Fatalf("failed to decode request arguments: %v", err)
+			}
+			wantArgs := map[string]interface{}{
+				"type":                 "0x2",
+				"from":                 address.Hex(),
+				"to":                   tx.To().Hex(),
+				"gas":                  "0x15f90",
+				"maxFeePerGas":         "0x6fc23ac00",
+				"maxPriorityFeePerGas": "0x3b9aca00",
+				"value":                "0x0",
+				"nonce":                "0xc",
+				"data":                 "0xcafe",
+				"chainId":              "0xaa36a7",
+			}
+			for name, want := range wantArgs {
+				if args[name] != want {
+					t.Errorf("request argument %s = %v, want %v", name, args[name], want)
+				}
+			}
+			if _, ok := args["gasPrice"]; ok {
+				t.Error("request arguments of a dynamic fee transaction include gasPrice")
+			}
+		})
+	}
+}
+
+func TestRemoteSignerRejectsDifferentTransaction(t *testing.T) {
+	key := mustGenerateKey(t)
+	service := &stubSignerService{
+		key:    key,
+		modify: func(args *remoteSignArgs) { args.Nonce++ },
+	}
+	signer := newStubRemoteSigner(t, "account", "", service, crypto.PubkeyToAddress(key.PublicKey))
+
+	_, err := signer.SignTx(context.Background(), newTestTransaction(), testChainID)
+	if err == nil || !strings.Contains(err.Error(), "different transaction") {
+		t.Errorf("SignTx error = %v, want a different transaction error", err)
+	}
+}
+
+func TestRemoteSignerAccessList(t *testing.T) {
+	to := common.HexToAddress("0x5fbdb2315678afecb367f032d93f642f64180aa3")
+	accessList := types.AccessList{
+		{Address: to, StorageKeys: []common.Hash{{0x01}, {0x02}}},
+		{Address: common.HexToAddress("0x01"), StorageKeys: []common.Hash{}},
+	}
+
+	tests := []struct {
+		name     string
+		tx       *types.Transaction
+		wantType string
+	}{
+		{
+			name: "dynamic fee",
+			tx: types.NewTx(&types.DynamicFeeTx{
+				ChainID: testChainID, Nonce: 3, GasTipCap: big.NewInt(1_000_000_000), GasFeeCap: big.NewInt(30_000_000_000),
+				Gas: 90_000, To: &to, Value: big.NewInt(0), AccessList: accessList,
+			}),
+			wantType: "0x2",
+		},
+		{
+			name: "access list",
+			tx: types.NewTx(&types.AccessListTx{
+				ChainID: testChainID, Nonce: 4, GasPrice: big.NewInt(20_000_000_000), Gas: 90_000, To: &to,
+				Value: big.NewInt(0), AccessList: accessList,
+			}),
+			wantType: "0x1",
+		},
+		{
+			name:     "legacy",
+			tx:       types.NewTx(&types.LegacyTx{Nonce: 5, GasPrice: big.NewInt(20_000_000_000), Gas: 21_000, To: &to, Value: big.NewInt(1)}),
+			wantType: "0x0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := mustGenerateKey(t)
+			service := &stubSignerService{key: key}
+			signer := newStubRemoteSigner(t, "account", "", service, crypto.PubkeyToAddress(key.PublicKey))
+
+			signedTx, err := signer.SignTx(context.Background(), tt.tx, testChainID)
+			if err != nil {
+				t.Fatalf("SignTx failed: %v", err)
+			}
+			if signedTx.Type() != tt.tx.Type() {
+				t.Errorf("signed transaction type = %d, want %d", signedTx.Type(), tt.tx.Type())
+			}
+
+			var args struct {
+				Type       string            `json:"type"`
+				AccessList *types.AccessList `json:"accessList"`
+			}
+			err = json.Unmarshal(service.args, &args)
+			if err != nil {
+				t.Fatalf("failed to decode request arguments: %v", err)
+			}
+			if args.Type != tt.wantType {
+				t.Errorf("request argument type = %s, want %s", args.Type, tt.wantType)
+			}
+			if tt.tx.Type() == types.LegacyTxType {
+				if args.AccessList != nil {
+					t.Errorf("request arguments of a legacy transaction include accessList %v", *args.AccessList)
+				}
+				return
+			}
+			if args.AccessList == nil || len(*args.AccessList) != len(accessList) {
+				t.Fatalf("request argument accessList = %v, want %v", args.AccessList, accessList)
+			}
+			for i, tuple := range *args.AccessList {
+				if tuple.Address != accessList[i].Address || len(tuple.StorageKeys) != len(accessList[i].StorageKeys) {
+					t.Errorf("request argument accessList[%d] = %v, want %v", i, tuple, accessList[i])
+				}
+			}
+		})
+	}
+
+	t.Run("signer drops the access list", func(t *testing.T) {
+		key := mustGenerateKey(t)
+		service := &stubSignerService{
+			key:    key,
+			modify: func(args *remoteSignArgs) { args.AccessList = nil },
+		}
+		signer := newStubRemoteSigner(t, "account", "", service, crypto.PubkeyToAddress(key.PublicKey))
+
+		_, err := signer.SignTx(context.Background(), tests[0].tx, testChainID)
+		if err == nil || !strings.Contains(err.Error(), "different transaction") {
+			t.Errorf("SignTx error = %v, want a different transaction error", err)
+		}
+	})
+}
+
+func TestRemoteSignerRejectsWrongSender(t *testing.T) {
+	service := &stubSignerService{key: mustGenerateKey(t)}
+	expected := crypto.PubkeyToAddress(mustGenerateKey(t).PublicKey)
+	signer := newStubRemoteSigner(t, "eth", "eth_signTransaction", service, expected)
+
+	_, err := signer.SignTx(context.Background(), newTestTransaction(), testChainID)
+	if err == nil || !strings.Contains(err.Error(), "instead of "+expected.Hex()) {
+		t.Errorf("SignTx error = %v, want a wrong sender error", err)
+	}
+}
+
+func TestKeystoreSigner(t *testing.T) {
+	dir := t.TempDir()
+	key := mustGenerateKey(t)
+
+	ks := keystore.NewKeyStore(filepath.Join(dir, "keystore"), keystore.LightScryptN, keystore.LightScryptP)
+	account, err := ks.ImportECDSA(key, "correct horse")
+	if err != nil {
+		t.Fatalf("failed to store key: %v", err)
+	}
+
+	// Passphrase files usually end with a newline, which is not part of the passphrase.
+	passphraseFile := filepath.Join(dir, "passphrase")
+	err = os.WriteFile(passphraseFile, []byte("correct horse\n"), 0o600)
+	if err != nil {
+		t.Fatalf("failed to write passphrase file: %v", err)
+	}
+
+	signer, err := NewKeystoreSigner(account.URL.Path, passphraseFile)
+	if err != nil {
+		t.Fatalf("NewKeystoreSigner failed: %v", err)
+	}
+	if signer.Address() != account.Address {
+		t.Errorf("Address() = %s, want %s", signer.Address().Hex(), account.Address.Hex())
+	}
+
+	signedTx, err := signer.SignTx(context.Background(), newTestTransaction(), testChainID)
+	if err != nil {
+		t.Fatalf("SignTx failed: %v", err)
+	}
+	sender, err := types.Sender(types.LatestSignerForChainID(testChainID), signedTx)
+	if err != nil || sender != account.Address {
+		t.Errorf("signed transaction sender = %s (%v), want %s", sender.Hex(), err, account.Address.Hex())
+	}
+
+	wrongPassphraseFile := filepath.Join(dir, "wrong-passphrase")
+	err = os.WriteFile(wrongPassphraseFile, []byte("wrong horse\n"), 0o600)
+	if err != nil {
+		t.Fatalf("failed to write passphrase file: %v", err)
+	}
+	_, err = NewKeystoreSigner(account.URL.Path, wrongPassphraseFile)
+	if err == nil {
+		t.Error("NewKeystoreSigner succeeded with a wrong passphrase")
+	}
+}
@@ -0,0 +1,144 @@
+package web3
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"eth-fetcher.ddzhalev.net/internal/models"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// TransferEventID is the topic of the ERC-20 and ERC-721 Transfer events.
+var TransferEventID = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+
+const tokenMetadataABI = `[
+	{"type":"function","name":"name","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"string"}]},
+	{"type":"function","name":"symbol","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"string"}]},
+	{"type":"function","name":"decimals","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"uint8"}]}
+]`
+
+var builtinTokenMetadataABI = mustParseABI(tokenMetadataABI)
+
+// FetchTokenMetadata reads name, symbol and decimals of the given tokens with
+// JSON-RPC batches of at most maxBatchSize eth_call requests, or with individual
+// calls if maxBatchSize is 0. Fields a token does not implement are left nil.
+func FetchTokenMetadata(ctx context.Context, client *rpc.Client, addresses []common.Address, maxBatchSize int) ([]*models.TokenMetadata, error) {
+	methods := []string{"name", "symbol", "decimals"}
+	results := make([]hexutil.Bytes, len(addresses)*len(methods))
+	elems := make([]rpc.BatchElem, 0, len(results))
+	for i, address := range addresses {
+		for j, method := range methods {
+			data, err := builtinTokenMetadataABI.Pack(method)
+			if err != nil {
+				return nil, err
+			}
+
+			call := map[string]interface{}{"to": address, "data": hexutil.Bytes(data)}
+			elems = append(elems, rpc.BatchElem{Method: "eth_call", Args: []interface{}{call, "latest"}, Result: &results[i*len(methods)+j]})
+		}
+	}
+
+	if err := callInChunks(ctx, client, elems, maxBatchSize); err != nil {
+		return nil, err
+	}
+
+	metadata := make([]*models.TokenMetadata, len(addresses))
+	for i, address := range addresses {
+		token := &models.TokenMetadata{Address: address.Hex()}
+		offset := i * len(methods)
+
+		if elems[offset].Error == nil {
+			token.Name = unpackTokenString("name", results[offset])
+		}
+		if elems[offset+1].Error == nil {
+			token.Symbol = unpackTokenString("symbol", results[offset+1])
+		}
+		if elems[offset+2].Error == nil {
+			values, err := builtinTokenMetadataABI.Unpack("decimals", results[offset+2])
+			if err == nil && len(values) == 1 {
+				decimals := int(values[0].(uint8))
+				token.Decimals = &decimals
+			}
+		}
+
+		metadata[i] = token
+	}
+
+	return metadata, nil
+}
+
+// callInChunks sends elems in batches of at most maxBatchSize, or one by one if
+// maxBatchSize is 0. Unlike batchCall it does not treat a chunk in which every
+// call failed as rejected, since calls to contracts that are not tokens revert.
+func callInChunks(ctx context.Context, client *rpc.Client, elems []rpc.BatchElem, maxBatchSize int) error {
+	if maxBatchSize <= 0 {
+		for i := range elems {
+			err := client.CallContext(ctx, elems[i].Result, elems[i].Method, elems[i].Args...)
+			var rpcErr rpc.Error
+			if err != nil && !errors.As(err, &rpcErr) {
+				return err
+			}
+			elems[i].Error = err
+		}
+		return nil
+	}
+
+	for start := 0; start < len(elems); start += maxBatchSize {
+		chunk := elems[start:min(start+maxBatchSize, len(elems))]
+		if err := client.BatchCallContext(ctx, chunk); err != nil {
+			return fmt.Errorf("batch request failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// unpackTokenString decodes a string returned by name or symbol. Some older tokens
+// return bytes32 instead of string, which is decoded as a zero-padded string.
+func unpackTokenString(method string, data []byte) *string {
+	values, err := builtinTokenMetadataABI.Unpack(method, data)
+	if err == nil && len(values) == 1 {
+		value := values[0].(string)
+		return &value
+	}
+
+	if len(data) == 32 {
+		value := string(bytes.TrimRight(data, "\x00"))
+		return &value
+	}
+
+	return nil
+}
+
+var ErrNotTokenTransfer = errors.New("log is not a token transfer")
+
+// ParseTokenTransfer recognizes ERC-20 and ERC-721 Transfer events. Both share the
+// same topic; ERC-721 indexes the token ID while ERC-20 puts the amount in data.
+func ParseTokenTransfer(address common.Address, topics []common.Hash, data []byte) (*models.TokenTransfer, error) {
+	if len(topics) == 0 || topics[0] != TransferEventID {
+		return nil, ErrNotTokenTransfer
+	}
+
+	transfer := &models.TokenTransfer{TokenAddress: address.Hex()}
+	switch {
+	case len(topics) == 3 && len(data) == 32:
+		amount := new(big.Int).SetBytes(data).String()
+		transfer.Standard = models.TokenStandardERC20
+		transfer.Amount = &amount
+	case len(topics) == 4 && len(data) == 0:
+		tokenID := topics[3].Big().String()
+		transfer.Standard = models.TokenStandardERC721
+		transfer.TokenID = &tokenID
+	default:
+		return nil, ErrNotTokenTransfer
+	}
+
+	transfer.From = common.BytesToAddress(topics[1].Bytes()).Hex()
+	transfer.To = common.BytesToAddress(topics[2].Bytes()).Hex()
+	return transfer, nil
+}
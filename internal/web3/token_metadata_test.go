@@ -0,0 +1,124 @@
+package web3
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// stubTokenService answers eth_call for the token metadata methods of a token
+// named "Token" with symbol "TKN" and 6 decimals.
+type stubTokenService struct{}
+
+func (stubTokenService) Call(call map[string]interface{}, _ string) (hexutil.Bytes, error) {
+	data, err := hexutil.Decode(call["data"].(string))
+	if err != nil {
+		return nil, err
+	}
+
+	method, err := builtinTokenMetadataABI.MethodById(data)
+	if err != nil {
+		return nil, err
+	}
+	switch method.Name {
+	case "name":
+		return method.Outputs.Pack("Token")
+	case "symbol":
+		return method.Outputs.Pack("TKN")
+	default:
+		return method.Outputs.Pack(uint8(6))
+	}
+}
+
+// requestRecorder records the number of calls in each JSON-RPC request it
+// passes on, counting a single call as a request of size 0.
+type requestRecorder struct {
+	mu    sync.Mutex
+	sizes []int
+	next  http.Handler
+}
+
+func (rr *requestRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	size := 0
+	var batch []json.RawMessage
+	if json.Unmarshal(body, &batch) == nil {
+		size = len(batch)
+	}
+
+	rr.mu.Lock()
+	rr.sizes = append(rr.sizes, size)
+	rr.mu.Unlock()
+	rr.next.ServeHTTP(w, r)
+}
+
+func TestFetchTokenMetadataBatchSize(t *testing.T) {
+	addresses := []common.Address{common.HexToAddress("0x01"), common.HexToAddress("0x02"), common.HexToAddress("0x03")}
+
+	tests := []struct {
+		name         string
+		maxBatchSize int
+		wantSizes    []int
+	}{
+		{name: "one batch", maxBatchSize: 100, wantSizes: []int{9}},
+		{name: "chunked", maxBatchSize: 4, wantSizes: []int{4, 4, 1}},
+		{name: "batching disabled", maxBatchSize: 0, wantSizes: []int{0, 0, 0, 0, 0, 0, 0, 0, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := rpc.NewServer()
+			err := server.RegisterName("eth", stubTokenService{})
+			if err != nil {
+				t.Fatalf("failed to register stub service: %v", err)
+			}
+			recorder := &requestRecorder{next: server}
+			httpServer := httptest.NewServer(recorder)
+			defer httpServer.Close()
+			defer server.Stop()
+
+			client, err := rpc.DialContext(context.Background(), httpServer.URL)
+			if err != nil {
+				t.Fatalf("failed to connect: %v", err)
+			}
+			defer client.Close()
+
+			metadata, err := FetchTokenMetadata(context.Background(), client, addresses, tt.maxBatchSize)
+			if err != nil {
+				t.Fatalf("FetchTokenMetadata failed: %v", err)
+			}
+
+			if len(recorder.sizes) != len(tt.wantSizes) {
+				t.Fatalf("request sizes = %v, want %v", recorder.sizes, tt.wantSizes)
+			}
+			for i, size := range recorder.sizes {
+				if size != tt.wantSizes[i] {
+					t.Fatalf("request sizes = %v, want %v", recorder.sizes, tt.wantSizes)
+				}
+			}
+
+			for i, token := range metadata {
+				if token.Address != addresses[i].Hex() {
+					t.Errorf("metadata[%d].Address = %s, want %s", i, token.Address, addresses[i].Hex())
+				}
+				if token.Name == nil || *token.Name != "Token" || token.Symbol == nil || *token.Symbol != "TKN" {
+					t.Errorf("metadata[%d] name = %v, symbol = %v, want Token, TKN", i, token.Name, token.Symbol)
+				}
+				if token.Decimals == nil || *token.Decimals != 6 {
+					t.Errorf("metadata[%d].Decimals = %v, want 6", i, token.Decimals)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package web3
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+var ErrTransactionPending = errors.New("transaction is still pending")
+
+// TransactionData groups the node responses needed to build a transaction record.
+// Pending transactions have no Receipt or Header.
+type TransactionData struct {
+	Transaction *types.Transaction
+	Receipt     *types.Receipt
+	Header      *types.Header
+	Pending     bool
+}
+
+// TransactionResult is the outcome of fetching a single hash in a batch.
+type TransactionResult struct {
+	Data *TransactionData
+	Err  error
+}
+
+type rpcTransaction struct {
+	tx *types.Transaction
+	txExtraInfo
+}
+
+type txExtraInfo struct {
+	BlockNumber *string      `json:"blockNumber,omitempty"`
+	BlockHash   *common.Hash `json:"blockHash,omitempty"`
+}
+
+func (tx *rpcTransaction) UnmarshalJSON(msg []byte) error {
+	if err := json.Unmarshal(msg, &tx.tx); err != nil {
+		return err
+	}
+	return json.Unmarshal(msg, &tx.txExtraInfo)
+}
+
+// FetchTransactionsBatch looks up the transactions, receipts and block headers for
+// the given hashes using JSON-RPC batch requests of at most maxBatchSize calls.
+// Failures of individual lookups are reported per hash in the returned results,
+// while a non-nil error means the node could not serve the batch at all.
+func FetchTransactionsBatch(ctx context.Context, client *rpc.Client, hashes []common.Hash, maxBatchSize int) ([]TransactionResult, error) {
+	txs := make([]*rpcTransaction, len(hashes))
+	receipts := make([]*types.Receipt, len(hashes))
+
+	elems := make([]rpc.BatchElem, 0, 2*len(hashes))
+	for i, hash := range hashes {
+		elems = append(elems,
+			rpc.BatchElem{Method: "eth_getTransactionByHash", Args: []interface{}{hash}, Result: &txs[i]},
+			rpc.BatchElem{Method: "eth_getTransactionReceipt", Args: []interface{}{hash}, Result: &receipts[i]},
+		)
+	}
+
+	if err := batchCall(ctx, client, elems, maxBatchSize); err != nil {
+		return nil, err
+	}
+
+	results := make([]TransactionResult, len(hashes))
+	headerIndexes := make(map[common.Hash]int)
+	var blockHashes []common.Hash
+	for i, hash := range hashes {
+		if err := firstError(elems[2*i].Error, elems[2*i+1].Error); err != nil {
+			results[i].Err = fmt.Errorf("failed to fetch transaction %s: %w", hash.Hex(), err)
+			continue
+		}
+
+		switch {
+		case txs[i] == nil:
+			results[i].Err = fmt.Errorf("failed to fetch transaction %s: %w", hash.Hex(), ethereum.NotFound)
+			continue
+		case txs[i].BlockNumber == nil:
+			results[i].Data = &TransactionData{Transaction: txs[i].tx, Pending: true}
+			continue
+		case receipts[i] == nil:
+			results[i].Err = fmt.Errorf("transaction %s: %w", hash.Hex(), ErrTransactionPending)
+			continue
+		}
+
+		results[i].Data = &TransactionData{Transaction: txs[i].tx, Receipt: receipts[i]}
+		if _, ok := headerIndexes[receipts[i].BlockHash]; !ok {
+			headerIndexes[receipts[i].BlockHash] = len(blockHashes)
+			blockHashes = append(blockHashes, receipts[i].BlockHash)
+		}
+	}
+
+	if len(blockHashes) == 0 {
+		return results, nil
+	}
+
+	headers := make([]*types.Header, len(blockHashes))
+	headerElems := make([]rpc.BatchElem, len(blockHashes))
+	for i, blockHash := range blockHashes {
+		headerElems[i] = rpc.BatchElem{Method: "eth_getBlockByHash", Args: []interface{}{blockHash, false}, Result: &headers[i]}
+	}
+
+	if err := batchCall(ctx, client, headerElems, maxBatchSize); err != nil {
+		return nil, err
+	}
+
+	for i, hash := range hashes {
+		if results[i].Data == nil || results[i].Data.Pending {
+			continue
+		}
+
+		j := headerIndexes[results[i].Data.Receipt.BlockHash]
+		switch {
+		case headerElems[j].Error != nil:
+			results[i] = TransactionResult{Err: fmt.Errorf("failed to fetch block header for transaction %s: %w", hash.Hex(), headerElems[j].Error)}
+		case headers[j] == nil:
+			results[i] = TransactionResult{Err: fmt.Errorf("failed to fetch block header for transaction %s: %w", hash.Hex(), ethereum.NotFound)}
+		default:
+			results[i].Data.Header = headers[j]
+		}
+	}
+
+	return results, nil
+}
+
+// batchCall sends elems in chunks of at most maxBatchSize. A chunk in which every
+// call failed is treated as the node rejecting batch requests.
+func batchCall(ctx context.Context, client *rpc.Client, elems []rpc.BatchElem, maxBatchSize int) error {
+	if maxBatchSize <= 0 {
+		maxBatchSize = len(elems)
+	}
+
+	for start := 0; start < len(elems); start += maxBatchSize {
+		chunk := elems[start:min(start+maxBatchSize, len(elems))]
+		if err := client.BatchCallContext(ctx, chunk); err != nil {
+			return fmt.Errorf("batch request failed: %w", err)
+		}
+
+		var failed int
+		for _, elem := range chunk {
+			if elem.Error != nil {
+				failed++
+			}
+		}
+		if len(chunk) > 1 && failed == len(chunk) {
+			return fmt.Errorf("batch request rejected: %w", chunk[0].Error)
+		}
+	}
+
+	return nil
+}
+
+func firstError(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -2,54 +2,41 @@ package web3
 
 import (
 	"context"
-	"crypto/ecdsa"
-	"errors"
+	"fmt"
 	"log"
 	"math/big"
 	"os"
-	"time"
 
 	"eth-fetcher.ddzhalev.net/internal/models"
 	ethereum "github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
 )
 
 type PersonInfoContractInteractor struct {
 	httpClient *ethclient.Client
-	wsClient   *ethclient.Client
+	events     EventSource
+	nonces     *NonceManager
+	fees       FeeConfig
 	contract   *SimplePersonInfoContract
-	privateKey *ecdsa.PrivateKey
+	signer     Signer
 	address    common.Address
 	chainID    *big.Int
 }
 
-func NewPersonInfoContractInteractor() (*PersonInfoContractInteractor, error) {
+// NewPersonInfoContractInteractor connects to ETH_NODE_URL and, when set, to
+// ETH_SOCKET_URL for event subscriptions. Without a websocket endpoint events are
+// polled over HTTP as configured by polling. Transactions are signed by signer
+// and sent with the gas limit and fees chosen as configured by fees.
+func NewPersonInfoContractInteractor(signer Signer, polling PollingConfig, fees FeeConfig) (*PersonInfoContractInteractor, error) {
 	httpClient, err := ethclient.Dial(os.Getenv("ETH_NODE_URL"))
 	if err != nil {
 		return nil, err
 	}
 
-	wsClient, err := ethclient.Dial(os.Getenv("ETH_SOCKET_URL"))
-	if err != nil {
-		return nil, err
-	}
-
-	privateKey, err := crypto.HexToECDSA(os.Getenv("PRIVATE_KEY"))
-	if err != nil {
-		return nil, err
-	}
-
-	publicKey := privateKey.Public()
-	publicKeyECDSA, ok := publicKey.(*ecdsa.PublicKey)
-	if !ok {
-		return nil, errors.New("error casting public key to ECDSA")
-	}
-
-	address := crypto.PubkeyToAddress(*publicKeyECDSA)
+	address := signer.Address()
 
 	contract, err := newContractInstance(httpClient)
 	if err != nil {
@@ -61,37 +48,100 @@ func NewPersonInfoContractInteractor() (*PersonInfoContractInteractor, error) {
 		return nil, err
 	}
 
+	var events EventSource
+	if wsURL := os.Getenv("ETH_SOCKET_URL"); wsURL != "" {
+		events, err = newWebsocketEventSource(wsURL)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		log.Printf("ETH_SOCKET_URL is not set, polling for events every %s", polling.Interval)
+		events = newPollingEventSource(httpClient, contract, polling)
+	}
+
 	return &PersonInfoContractInteractor{
 		httpClient: httpClient,
-		wsClient:   wsClient,
+		events:     events,
+		nonces:     NewNonceManager(httpClient, address),
+		fees:       fees,
 		contract:   contract,
-		privateKey: privateKey,
+		signer:     signer,
 		address:    address,
 		chainID:    chainID,
 	}, nil
 }
 
-func (pci *PersonInfoContractInteractor) SetPersonInfo(name string, age int) (string, bool, error) {
-	auth, err := pci.getTransactOpts()
+// SubmitPersonInfo sends a setPersonInfo transaction and returns it without
+// waiting for it to be mined. Its gas limit is estimated and its fees are picked
+// by suggestFees. Its nonce comes from the nonce manager, so concurrent calls
+// send transactions with consecutive nonces. The signed transaction is passed to
+// record before it is sent, and nothing is sent if record fails, so a sent
+// transaction is always recorded.
+func (pci *PersonInfoContractInteractor) SubmitPersonInfo(name string, age int, record func(*types.Transaction) error) (*types.Transaction, error) {
+	ctx := context.Background()
+
+	parsed, err := SimplePersonInfoContractMetaData.GetAbi()
 	if err != nil {
-		return "", false, err
+		return nil, err
+	}
+	data, err := parsed.Pack("setPersonInfo", name, big.NewInt(int64(age)))
+	if err != nil {
+		return nil, err
 	}
 
+	fees, err := pci.suggestFees(ctx)
+	if err != nil {
+		return nil, err
+	}
+	fees.GasLimit, err = pci.estimateGasLimit(ctx, PersonInfoContractAddress(), data, fees)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := pci.nonces.Next(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	auth := pci.getTransactOpts(ctx, nonce, fees)
+	auth.NoSend = true
 	tx, err := pci.contract.SetPersonInfo(auth, name, big.NewInt(int64(age)))
 	if err != nil {
-		return "", false, err
+		pci.nonces.Release(nonce)
+		return nil, err
 	}
 
-	receipt, err := pci.waitForTx(tx.Hash())
+	err = record(tx)
 	if err != nil {
-		return tx.Hash().Hex(), false, err
+		pci.nonces.Release(nonce)
+		return nil, err
 	}
 
-	if receipt.Status == types.ReceiptStatusSuccessful {
-		return tx.Hash().Hex(), true, nil
-	} else {
-		return tx.Hash().Hex(), false, nil
+	err = pci.httpClient.SendTransaction(ctx, tx)
+	if err != nil {
+		pci.nonces.Release(nonce)
+		if IsNonceError(err) {
+			log.Printf("Transaction with nonce %d rejected, resyncing nonces: %v", nonce, err)
+			if resyncErr := pci.nonces.Resync(ctx); resyncErr != nil {
+				log.Printf("Failed to resync nonces: %v", resyncErr)
+			}
+		}
+		return nil, err
 	}
+
+	pci.nonces.Confirm(nonce)
+	return tx, nil
+}
+
+// ResyncNonces reloads the sender's nonce from the node, handing out the nonce of
+// a transaction that went missing again.
+func (pci *PersonInfoContractInteractor) ResyncNonces(ctx context.Context) error {
+	return pci.nonces.Resync(ctx)
+}
+
+// Address returns the account transactions are sent from.
+func (pci *PersonInfoContractInteractor) Address() common.Address {
+	return pci.address
 }
 
 func (pci *PersonInfoContractInteractor) GetPersonInfo(index int) (string, int, error) {
@@ -110,93 +160,204 @@ func (pci *PersonInfoContractInteractor) GetPersonsCount() (int, error) {
 	return int(count.Int64()), nil
 }
 
-func (pci *PersonInfoContractInteractor) getTransactOpts() (*bind.TransactOpts, error) {
-	nonce, err := pci.httpClient.PendingNonceAt(context.Background(), pci.address)
-	if err != nil {
-		return nil, err
+// getTransactOpts returns the options of a transaction signed by the signer
+// with the given nonce and fees.
+func (pci *PersonInfoContractInteractor) getTransactOpts(ctx context.Context, nonce uint64, fees *TransactionFees) *bind.TransactOpts {
+	auth := &bind.TransactOpts{
+		From: pci.address,
+		Signer: func(address common.Address, tx *types.Transaction) (*types.Transaction, error) {
+			if address != pci.address {
+				return nil, bind.ErrNotAuthorized
+			}
+			return pci.signer.SignTx(ctx, tx, pci.chainID)
+		},
+		Context: ctx,
 	}
 
-	gasPrice, err := pci.httpClient.SuggestGasPrice(context.Background())
-	if err != nil {
-		return nil, err
-	}
+	auth.Nonce = new(big.Int).SetUint64(nonce)
+	auth.Value = big.NewInt(0) // in wei
+	auth.GasLimit = fees.GasLimit
+	auth.GasPrice = fees.GasPrice
+	auth.GasFeeCap = fees.GasFeeCap
+	auth.GasTipCap = fees.GasTipCap
 
-	auth, err := bind.NewKeyedTransactorWithChainID(pci.privateKey, pci.chainID)
-	if err != nil {
-		return nil, err
-	}
+	return auth
+}
 
-	auth.Nonce = big.NewInt(int64(nonce))
-	auth.Value = big.NewInt(0)     // in wei
-	auth.GasLimit = uint64(300000) // in units
-	auth.GasPrice = gasPrice
+// PersonInfoEventsCheckpoint is the checkpoint name under which ListenForEvents
+// records the last block whose PersonInfoUpdated events were all stored.
+const PersonInfoEventsCheckpoint = "personInfoEvents"
 
-	return auth, nil
+// EventBackfillConfig configures how ListenForEvents catches up on past events.
+type EventBackfillConfig struct {
+	// DeploymentBlock is where the backfill starts when there is no checkpoint yet.
+	DeploymentBlock uint64
+	// ChunkSize is the maximum number of blocks queried per eth_getLogs call.
+	ChunkSize uint64
 }
 
-func (pci *PersonInfoContractInteractor) ListenForEvents(ctx context.Context, eventModel *models.PersonInfoEventModel) {
-	wsContract, err := newContractInstance(pci.wsClient)
-	if err != nil {
-		log.Printf("Failed to create WebSocket contract instance: %v", err)
-		return
-	}
-
-	filterer := &SimplePersonInfoContractFilterer{contract: wsContract.SimplePersonInfoContractFilterer.contract}
+// ListenForEvents stores PersonInfoUpdated events as the event source delivers
+// them. It subscribes first and then backfills the events emitted between the
+// checkpoint and the current head, so no event is missed in between, including
+// after a reconnection. Events seen by both are stored once. It returns when the
+// subscription fails or ctx is cancelled, reporting its progress to health.
+func (pci *PersonInfoContractInteractor) ListenForEvents(ctx context.Context, eventModel *models.PersonInfoEventModel, checkpoints *models.CheckpointModel, backfill EventBackfillConfig, health *ListenerHealth) error {
+	health.setSource(pci.events.Name())
 
 	sink := make(chan *SimplePersonInfoContractPersonInfoUpdated)
-	sub, err := filterer.WatchPersonInfoUpdated(&bind.WatchOpts{Context: ctx}, sink, nil)
+	sub, err := pci.events.SubscribePersonInfoUpdated(ctx, sink)
 	if err != nil {
-		log.Printf("Failed to watch for PersonInfoUpdated events: %v", err)
-		return
+		return fmt.Errorf("failed to watch for PersonInfoUpdated events: %w", err)
 	}
 	defer sub.Unsubscribe()
 
+	health.setState(ListenerStateBackfilling)
+	processed, err := pci.backfillEvents(ctx, eventModel, checkpoints, backfill, health)
+	if err != nil {
+		return fmt.Errorf("failed to backfill PersonInfoUpdated events: %w", err)
+	}
+
+	health.setState(ListenerStateLive)
 	for {
 		select {
 		case event := <-sink:
-			err := eventModel.Insert(&models.PersonInfoEvent{
-				PersonIndex:     int(event.PersonIndex.Int64()),
-				PersonName:      event.NewName,
-				PersonAge:       int(event.NewAge.Int64()),
-				TransactionHash: event.Raw.TxHash.Hex(),
-			})
+			err := pci.storePersonInfoEvent(ctx, eventModel, event)
 			if err != nil {
-				log.Printf("Failed to insert event: %v", err)
-			} else {
-				log.Printf("Inserted new PersonInfoUpdated event: %s", event.Raw.TxHash.Hex())
+				log.Printf("Failed to store event: %v", err)
+				continue
+			}
+			health.recordEvent()
+
+			// Other events of the same block may still be on their way, so only the
+			// blocks before it are known to be complete.
+			if event.Raw.BlockNumber > processed+1 {
+				processed = event.Raw.BlockNumber - 1
+				err := checkpoints.Set(PersonInfoEventsCheckpoint, processed)
+				if err != nil {
+					log.Printf("Failed to save event checkpoint: %v", err)
+				}
+				health.setProcessed(processed)
 			}
 		case err := <-sub.Err():
-			log.Printf("Event subscription error: %v", err)
-			return
+			return fmt.Errorf("event subscription failed: %w", err)
 		case <-ctx.Done():
 			log.Println("Event listener stopped")
-			return
+			return ctx.Err()
 		}
 	}
 }
 
-func newContractInstance(client *ethclient.Client) (*SimplePersonInfoContract, error) {
-	return NewSimplePersonInfoContract(common.HexToAddress(os.Getenv("SIMPLE_PERSON_INFO_CONTRACT_ADDRESS")), client)
-}
+// backfillEvents stores the events emitted after the checkpoint up to the
+// current head in chunks, saving the checkpoint after each chunk. It returns the
+// last block it covered.
+func (pci *PersonInfoContractInteractor) backfillEvents(ctx context.Context, eventModel *models.PersonInfoEventModel, checkpoints *models.CheckpointModel, backfill EventBackfillConfig, health *ListenerHealth) (uint64, error) {
+	start := backfill.DeploymentBlock
+	checkpoint, err := checkpoints.Get(PersonInfoEventsCheckpoint)
+	if err == nil {
+		start = checkpoint + 1
+	} else if err.Error() != "checkpoint not found" {
+		return 0, err
+	}
 
-func (pci *PersonInfoContractInteractor) waitForTx(txHash common.Hash) (*types.Receipt, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
-	defer cancel()
+	head, err := pci.httpClient.BlockNumber(ctx)
+	if err != nil {
+		return 0, err
+	}
 
-	for {
-		receipt, err := pci.httpClient.TransactionReceipt(ctx, txHash)
-		if err == nil {
-			return receipt, nil
+	if start > head {
+		return head, nil
+	}
+
+	chunkSize := max(backfill.ChunkSize, 1)
+	log.Printf("Backfilling PersonInfoUpdated events from block %d to %d", start, head)
+
+	for from := start; from <= head; from += chunkSize {
+		to := min(from+chunkSize-1, head)
+
+		iter, err := pci.contract.FilterPersonInfoUpdated(&bind.FilterOpts{Start: from, End: &to, Context: ctx}, nil)
+		if err != nil {
+			return 0, err
 		}
 
-		if err != ethereum.NotFound {
-			return nil, err
+		var stored int
+		for iter.Next() {
+			err := pci.storePersonInfoEvent(ctx, eventModel, iter.Event)
+			if err != nil {
+				iter.Close()
+				return 0, err
+			}
+			stored++
+		}
+		err = iter.Error()
+		iter.Close()
+		if err != nil {
+			return 0, err
 		}
 
-		select {
-		case <-ctx.Done():
-			return nil, ctx.Err()
-		case <-time.After(time.Second):
+		err = checkpoints.Set(PersonInfoEventsCheckpoint, to)
+		if err != nil {
+			return 0, err
 		}
+		health.setProcessed(to)
+
+		if stored > 0 {
+			log.Printf("Backfilled %d PersonInfoUpdated events in blocks %d to %d", stored, from, to)
+		}
+	}
+
+	return head, nil
+}
+
+// storePersonInfoEvent stores event with the timestamp of its block, or deletes it
+// if its log was removed because its block was reorganized away.
+func (pci *PersonInfoContractInteractor) storePersonInfoEvent(ctx context.Context, eventModel *models.PersonInfoEventModel, event *SimplePersonInfoContractPersonInfoUpdated) error {
+	if event.Raw.Removed {
+		err := eventModel.DeleteByLog(event.Raw.TxHash.Hex(), event.Raw.Index, event.Raw.BlockHash.Hex())
+		if err != nil {
+			return err
+		}
+		log.Printf("Deleted removed PersonInfoUpdated event: %s", event.Raw.TxHash.Hex())
+		return nil
+	}
+
+	header, err := pci.httpClient.HeaderByHash(ctx, event.Raw.BlockHash)
+	if err != nil {
+		return fmt.Errorf("failed to fetch block %s: %w", event.Raw.BlockHash.Hex(), err)
 	}
+
+	err = eventModel.Insert(&models.PersonInfoEvent{
+		PersonIndex:     int(event.PersonIndex.Int64()),
+		PersonName:      event.NewName,
+		PersonAge:       int(event.NewAge.Int64()),
+		TransactionHash: event.Raw.TxHash.Hex(),
+		BlockNumber:     event.Raw.BlockNumber,
+		BlockHash:       event.Raw.BlockHash.Hex(),
+		LogIndex:        event.Raw.Index,
+		BlockTimestamp:  header.Time,
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("Inserted new PersonInfoUpdated event: %s", event.Raw.TxHash.Hex())
+	return nil
+}
+
+// SubscribeNewHeads subscribes to new chain heads through the event source.
+func (pci *PersonInfoContractInteractor) SubscribeNewHeads(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error) {
+	return pci.events.SubscribeNewHeads(ctx, ch)
+}
+
+// Reconnect re-establishes the event source connection. Existing subscriptions
+// end with an error.
+func (pci *PersonInfoContractInteractor) Reconnect(ctx context.Context) error {
+	return pci.events.Reconnect(ctx)
+}
+
+func newContractInstance(client *ethclient.Client) (*SimplePersonInfoContract, error) {
+	return NewSimplePersonInfoContract(PersonInfoContractAddress(), client)
+}
+
+// PersonInfoContractAddress returns the configured SimplePersonInfoContract address.
+func PersonInfoContractAddress() common.Address {
+	return common.HexToAddress(os.Getenv("SIMPLE_PERSON_INFO_CONTRACT_ADDRESS"))
 }